@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+)
+
+// routeInfo is the summary of a route returned by /_routes
+type routeInfo struct {
+	Method       string `json:"method"`
+	Path         string `json:"path"`
+	RequiresAuth bool   `json:"requiresAuth"`
+	Enabled      bool   `json:"enabled"`
+	Status       int    `json:"status"`
+}
+
+// routesHandler lists the routes currently being served, reflecting any reloads
+func (h *MockHandler) routesHandler(w http.ResponseWriter, r *http.Request) {
+	h.mu.RLock()
+	routes := make([]routeInfo, 0, len(h.routes))
+	for _, route := range h.routes {
+		routes = append(routes, routeInfo{
+			Method:       route.methodList(),
+			Path:         h.publicPath(route.Path),
+			RequiresAuth: route.RequiresAuth,
+			Enabled:      route.isEnabled(),
+			Status:       route.firstStatus(),
+		})
+	}
+	h.mu.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{"routes": routes})
+}
+
+// reloadHandler re-reads the config file on POST and swaps in the new routes
+// If the config fails to load or validate, the current routes are kept and a 400 is returned
+func reloadHandler(filename string, handlers []*MockHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+
+		log.Printf("Reload requested, reloading: %s", filename)
+		config, err := reloadConfig(filename, handlers)
+		if err != nil {
+			log.Printf("  ✗ Reload failed, keeping previous routes: %v", err)
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		log.Printf("  ✓ Reloaded %d routes", config.routeCount())
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]interface{}{"status": "reloaded", "routes": config.routeCount()})
+	}
+}
+
+// resetHandler clears stateful data and sequence positions on POST
+func (h *MockHandler) resetHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	cleared := h.Reset()
+	log.Printf("Reset requested: cleared %d stored items", cleared)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{"status": "reset", "cleared": cleared})
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+)
+
+// Supported values for Route.AuthType
+const (
+	authTypeHeader = "header"
+	authTypeBasic  = "basic"
+)
+
+// checkAuth enforces the route's auth requirement, writing a 401 if it isn't met
+// It returns false when the request was rejected
+func checkAuth(w http.ResponseWriter, r *http.Request, route *Route) bool {
+	lg := loggerFrom(r)
+
+	if route.AuthType == authTypeBasic {
+		username, password, ok := r.BasicAuth()
+		if !ok || username != route.Username || password != route.Password {
+			lg.Errorf("  ✗ Auth failed: invalid basic auth credentials")
+			w.Header().Set("WWW-Authenticate", `Basic realm="mockery-api"`)
+			http.Error(w, "Unauthorized: invalid credentials", http.StatusUnauthorized)
+			return false
+		}
+		lg.Printf("  ✓ Basic auth for '%s' accepted", username)
+		return true
+	}
+
+	authValue := r.Header.Get(route.AuthHeader)
+	if authValue == "" {
+		lg.Errorf("  ✗ Auth failed: missing header '%s'", route.AuthHeader)
+		http.Error(w, "Unauthorized: missing auth header", http.StatusUnauthorized)
+		return false
+	}
+	if route.AuthToken != "" && authToken(route.AuthHeader, authValue) != route.AuthToken {
+		lg.Errorf("  ✗ Auth failed: invalid token in header '%s'", route.AuthHeader)
+		http.Error(w, "Unauthorized: invalid auth token", http.StatusUnauthorized)
+		return false
+	}
+	lg.Printf("  ✓ Auth header '%s' present", route.AuthHeader)
+	return true
+}
+
+// authToken extracts the token from an auth header value
+// For the Authorization header a leading "Bearer " scheme is stripped
+func authToken(header, value string) string {
+	if strings.EqualFold(header, "Authorization") {
+		if len(value) > 7 && strings.EqualFold(value[:7], "Bearer ") {
+			return value[7:]
+		}
+	}
+	return value
+}
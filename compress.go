@@ -0,0 +1,143 @@
+package main
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+)
+
+// Content codings the server can compress responses with
+const (
+	encodingBrotli = "br"
+	encodingGzip   = "gzip"
+)
+
+// compressor is a compressing writer that can flush buffered data to the client
+type compressor interface {
+	io.WriteCloser
+	Flush() error
+}
+
+// compressResponseWriter compresses the response body with the negotiated encoding
+// Compression is decided when the header is written, so responses without
+// a body or that are already encoded are passed through untouched
+type compressResponseWriter struct {
+	http.ResponseWriter
+	request     *http.Request
+	encoding    string
+	enc         compressor
+	wroteHeader bool
+}
+
+// newCompressResponseWriter wraps w for a request that accepts the given encoding
+func newCompressResponseWriter(w http.ResponseWriter, r *http.Request, encoding string) *compressResponseWriter {
+	return &compressResponseWriter{ResponseWriter: w, request: r, encoding: encoding}
+}
+
+// WriteHeader sets the encoding headers if the response will be compressed
+func (c *compressResponseWriter) WriteHeader(status int) {
+	if c.wroteHeader {
+		return
+	}
+	c.wroteHeader = true
+
+	header := c.Header()
+	header.Add("Vary", "Accept-Encoding")
+	if bodyAllowed(c.request, status) && header.Get("Content-Encoding") == "" {
+		header.Set("Content-Encoding", c.encoding)
+		header.Del("Content-Length")
+		if c.encoding == encodingBrotli {
+			c.enc = brotli.NewWriter(c.ResponseWriter)
+		} else {
+			c.enc = gzip.NewWriter(c.ResponseWriter)
+		}
+	}
+	c.ResponseWriter.WriteHeader(status)
+}
+
+// Write compresses the data if compression is active
+func (c *compressResponseWriter) Write(b []byte) (int, error) {
+	if !c.wroteHeader {
+		c.WriteHeader(http.StatusOK)
+	}
+	if c.enc == nil {
+		return c.ResponseWriter.Write(b)
+	}
+	return c.enc.Write(b)
+}
+
+// Flush flushes buffered compressed data through to the client
+func (c *compressResponseWriter) Flush() {
+	c.FlushError()
+}
+
+// FlushError flushes buffered compressed data, reporting an error if the
+// underlying writer can't flush
+func (c *compressResponseWriter) FlushError() error {
+	if c.enc != nil {
+		if err := c.enc.Flush(); err != nil {
+			return err
+		}
+	}
+	return http.NewResponseController(c.ResponseWriter).Flush()
+}
+
+// Close finishes the compressed stream
+func (c *compressResponseWriter) Close() error {
+	if c.enc == nil {
+		return nil
+	}
+	return c.enc.Close()
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController
+func (c *compressResponseWriter) Unwrap() http.ResponseWriter {
+	return c.ResponseWriter
+}
+
+// negotiateEncoding picks the encoding the client's Accept-Encoding gives the
+// highest quality value, preferring brotli over gzip when they tie, or "" for
+// identity if it accepts neither
+func negotiateEncoding(r *http.Request) string {
+	quality := map[string]float64{}
+	wildcard := -1.0
+	for _, part := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		coding = strings.ToLower(strings.TrimSpace(coding))
+		q := 1.0
+		if value, ok := strings.CutPrefix(strings.ReplaceAll(params, " ", ""), "q="); ok {
+			if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+				q = parsed
+			}
+		}
+		if coding == "*" {
+			wildcard = q
+		} else {
+			quality[coding] = q
+		}
+	}
+
+	best, bestQ := "", 0.0
+	for _, encoding := range []string{encodingBrotli, encodingGzip} {
+		q, ok := quality[encoding]
+		if !ok {
+			q = wildcard
+		}
+		if q > bestQ {
+			best, bestQ = encoding, q
+		}
+	}
+	return best
+}
+
+// bodyAllowed reports whether a response with this status may carry a body
+func bodyAllowed(r *http.Request, status int) bool {
+	if r.Method == http.MethodHead {
+		return false
+	}
+	return status >= 200 && status != http.StatusNoContent && status != http.StatusNotModified
+}
@@ -1,48 +1,400 @@
 package main
 
 import (
+	"bytes"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
 	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/santhosh-tekuri/jsonschema/v6"
 )
 
 // Config represents the main configuration structure
 type Config struct {
-	Server ServerConfig `json:"server"`
-	Routes []Route      `json:"routes"`
+	Server          ServerConfig `json:"server"`
+	Routes          []Route      `json:"routes"`
+	DefaultResponse *Response    `json:"defaultResponse,omitempty"`
+	Servers         []Config     `json:"servers,omitempty"`
+}
+
+// serverGroups returns each server the config defines: the entries of servers
+// when it lists several, otherwise the config itself
+func (c *Config) serverGroups() []*Config {
+	if len(c.Servers) == 0 {
+		return []*Config{c}
+	}
+	groups := make([]*Config, len(c.Servers))
+	for i := range c.Servers {
+		groups[i] = &c.Servers[i]
+	}
+	return groups
+}
+
+// httpsPort returns the port of the first server serving TLS, or 0 if none does
+func (c *Config) httpsPort() int {
+	for _, group := range c.serverGroups() {
+		if group.Server.TLS != nil {
+			return group.Server.Port
+		}
+	}
+	return 0
+}
+
+// logFile returns the file to write logs to, empty for the console
+// Logging is process-wide, so servers that set it must agree on the file
+func (c *Config) logFile() string {
+	for _, group := range c.serverGroups() {
+		if group.Server.LogFile != "" {
+			return group.Server.LogFile
+		}
+	}
+	return ""
+}
+
+// routeCount returns the number of routes across all servers
+func (c *Config) routeCount() int {
+	count := 0
+	for _, group := range c.serverGroups() {
+		count += len(group.Routes)
+	}
+	return count
 }
 
 // ServerConfig holds server-specific settings
 type ServerConfig struct {
-	Port int `json:"port"`
+	Host                 string            `json:"host,omitempty"`
+	Port                 int               `json:"port"`
+	CORS                 *CORSConfig       `json:"cors,omitempty"`
+	RateLimit            *RateLimitConfig  `json:"rateLimit,omitempty"`
+	RequestLog           string            `json:"requestLog,omitempty"`
+	LogFile              string            `json:"logFile,omitempty"`
+	DumpRequests         string            `json:"dumpRequests,omitempty"`
+	Compression          bool              `json:"compression,omitempty"`
+	ETag                 bool              `json:"etag,omitempty"`
+	HTTP2                bool              `json:"http2,omitempty"`
+	TLS                  *TLSConfig        `json:"tls,omitempty"`
+	CaseInsensitivePaths bool              `json:"caseInsensitivePaths,omitempty"`
+	StrictSlash          bool              `json:"strictSlash,omitempty"`
+	TrustProxyHeaders    bool              `json:"trustProxyHeaders,omitempty"`
+	RequestID            bool              `json:"requestId,omitempty"`
+	BasePath             string            `json:"basePath,omitempty"`
+	LogFormat            string            `json:"logFormat,omitempty"`
+	LogLevel             string            `json:"logLevel,omitempty"`
+	DefaultHeaders       map[string]string `json:"defaultHeaders,omitempty"`
+	StatusOverrideHeader string            `json:"statusOverrideHeader,omitempty"`
+	NotFoundBody         interface{}       `json:"notFoundBody,omitempty"`
+	MethodNotAllowedBody interface{}       `json:"methodNotAllowedBody,omitempty"`
+	MaxBodyBytes         int64             `json:"maxBodyBytes,omitempty"`
+	MaxConcurrent        int               `json:"maxConcurrent,omitempty"`
+	QueueWhenBusy        bool              `json:"queueWhenBusy,omitempty"`
+	Timeouts             *TimeoutsConfig   `json:"timeouts,omitempty"`
+	Health               *HealthConfig     `json:"health,omitempty"`
+	StartupDelayMs       int               `json:"startupDelayMs,omitempty"`
+	Middleware           []string          `json:"middleware,omitempty"`
+	RedirectToHTTPS      bool              `json:"redirectToHttps,omitempty"`
+}
+
+// CORSConfig holds cross-origin resource sharing settings
+type CORSConfig struct {
+	AllowedOrigins []string `json:"allowedOrigins"`
+	AllowedMethods []string `json:"allowedMethods,omitempty"`
+	AllowedHeaders []string `json:"allowedHeaders,omitempty"`
+}
+
+// TLSConfig enables HTTPS using a certificate pair or a generated self-signed certificate
+type TLSConfig struct {
+	CertFile   string `json:"certFile,omitempty"`
+	KeyFile    string `json:"keyFile,omitempty"`
+	SelfSigned bool   `json:"selfSigned,omitempty"`
+}
+
+// HealthConfig replaces the response of the /_health endpoint
+type HealthConfig struct {
+	Status int         `json:"status,omitempty"`
+	Body   interface{} `json:"body"`
+}
+
+// TimeoutsConfig bounds how long the server waits on slow clients, in milliseconds
+// Zero values fall back to the defaults
+type TimeoutsConfig struct {
+	ReadMs  int `json:"readMs,omitempty"`
+	WriteMs int `json:"writeMs,omitempty"`
+	IdleMs  int `json:"idleMs,omitempty"`
+}
+
+// RateLimitConfig throttles requests using a token bucket
+type RateLimitConfig struct {
+	RequestsPerSecond float64 `json:"requestsPerSecond"`
+	Burst             int     `json:"burst,omitempty"`
+	PerClient         bool    `json:"perClient,omitempty"`
 }
 
 // Route represents a single API endpoint configuration
 type Route struct {
-	Path         string            `json:"path"`
-	Method       string            `json:"method"`
-	RequiresAuth bool              `json:"requiresAuth"`
-	AuthHeader   string            `json:"authHeader"`
-	Response     Response          `json:"response"`
+	Path                string                 `json:"path"`
+	Method              string                 `json:"method,omitempty"`
+	Methods             []string               `json:"methods,omitempty"`
+	Enabled             *bool                  `json:"enabled,omitempty"`
+	RequiresAuth        bool                   `json:"requiresAuth"`
+	AuthHeader          string                 `json:"authHeader"`
+	AuthToken           string                 `json:"authToken,omitempty"`
+	AuthType            string                 `json:"authType,omitempty"`
+	Username            string                 `json:"username,omitempty"`
+	Password            string                 `json:"password,omitempty"`
+	Query               map[string]string      `json:"query,omitempty"`
+	QueryPresent        []string               `json:"queryPresent,omitempty"`
+	BodyMatch           map[string]interface{} `json:"bodyMatch,omitempty"`
+	FormMatch           map[string]string      `json:"formMatch,omitempty"`
+	ContentType         string                 `json:"contentType,omitempty"`
+	CookieMatch         map[string]string      `json:"cookieMatch,omitempty"`
+	RequireTLS          *bool                  `json:"requireTls,omitempty"`
+	RequestSchema       interface{}            `json:"requestSchema,omitempty"`
+	RateLimit           *RateLimitConfig       `json:"rateLimit,omitempty"`
+	ProxyTo             string                 `json:"proxyTo,omitempty"`
+	Stateful            bool                   `json:"stateful,omitempty"`
+	Capture             map[string]string      `json:"capture,omitempty"`
+	Idempotent          bool                   `json:"idempotent,omitempty"`
+	IdempotencyTTLMs    int                    `json:"idempotencyTtlMs,omitempty"`
+	AllowStatusOverride bool                   `json:"allowStatusOverride,omitempty"`
+	Quiet               bool                   `json:"quiet,omitempty"`
+	MaxHits             int                    `json:"maxHits,omitempty"`
+	Priority            int                    `json:"priority,omitempty"`
+	Response            Response               `json:"response"`
+	Responses           []Response             `json:"responses,omitempty"`
+	WeightedResponses   []WeightedResponse     `json:"weightedResponses,omitempty"`
+	ResponseByHitCount  []HitRange             `json:"responseByHitCount,omitempty"`
+	When                []Condition            `json:"when,omitempty"`
+
+	// requestSchema is RequestSchema compiled when the config is loaded
+	requestSchema *jsonschema.Schema
+}
+
+// WeightedResponse is a response picked at random with probability proportional to its weight
+type WeightedResponse struct {
+	Weight   int      `json:"weight"`
+	Response Response `json:"response"`
+}
+
+// HitRange is a response sent for the From-th through To-th requests to a route,
+// counting from 1. A To of 0 leaves the range open-ended
+type HitRange struct {
+	From     int      `json:"from"`
+	To       int      `json:"to,omitempty"`
+	Response Response `json:"response"`
+}
+
+// covers reports whether the n-th request falls in the range
+func (h *HitRange) covers(n int) bool {
+	return n >= h.From && (h.To == 0 || n <= h.To)
+}
+
+// Supported values for Response.DelayDistribution
+const (
+	delayUniform     = "uniform"
+	delayNormal      = "normal"
+	delayExponential = "exponential"
+)
+
+// SSEEvent is one server-sent event; data is sent as-is if it's a string, otherwise as JSON
+type SSEEvent struct {
+	ID    string      `json:"id,omitempty"`
+	Event string      `json:"event,omitempty"`
+	Data  interface{} `json:"data,omitempty"`
+	Retry int         `json:"retry,omitempty"`
+}
+
+// CookieSpec describes a cookie to set on a response
+// MaxAge is in seconds: zero leaves it unset (a session cookie) and negative deletes the cookie
+type CookieSpec struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Path   string `json:"path,omitempty"`
+	MaxAge int    `json:"maxAge,omitempty"`
+}
+
+// Condition selects an alternative response when a request header has a given value
+type Condition struct {
+	Header   string   `json:"header"`
+	Value    string   `json:"value"`
+	Response Response `json:"response"`
 }
 
 // Response represents the mock response configuration
 type Response struct {
-	Status  int                    `json:"status"`
-	Headers map[string]string      `json:"headers,omitempty"`
-	Body    interface{}            `json:"body"`
+	Status            int               `json:"status"`
+	Headers           map[string]string `json:"headers,omitempty"`
+	SetCookies        []CookieSpec      `json:"setCookies,omitempty"`
+	RemoveHeaders     []string          `json:"removeHeaders,omitempty"`
+	Body              interface{}       `json:"body"`
+	BodyFile          string            `json:"bodyFile,omitempty"`
+	BodyRaw           string            `json:"bodyRaw,omitempty"`
+	BodyBase64        string            `json:"bodyBase64,omitempty"`
+	BodyXML           interface{}       `json:"bodyXml,omitempty"`
+	BodyTemplate      string            `json:"bodyTemplate,omitempty"`
+	MergeFromRequest  map[string]string `json:"mergeFromRequest,omitempty"`
+	Stream            []interface{}     `json:"stream,omitempty"`
+	StreamIntervalMs  int               `json:"streamIntervalMs,omitempty"`
+	SSE               []SSEEvent        `json:"sse,omitempty"`
+	SSEIntervalMs     int               `json:"sseIntervalMs,omitempty"`
+	SSELoop           bool              `json:"sseLoop,omitempty"`
+	DelayMs           int               `json:"delayMs,omitempty"`
+	DelayMinMs        int               `json:"delayMinMs,omitempty"`
+	DelayMaxMs        int               `json:"delayMaxMs,omitempty"`
+	DelayDistribution string            `json:"delayDistribution,omitempty"`
+	DelayMeanMs       int               `json:"delayMeanMs,omitempty"`
+	DelayStdDevMs     int               `json:"delayStdDevMs,omitempty"`
+	DripMs            int               `json:"dripMs,omitempty"`
+	DripChunkSize     int               `json:"dripChunkSize,omitempty"`
+	FailureRate       float64           `json:"failureRate,omitempty"`
+	FailureStatus     int               `json:"failureStatus,omitempty"`
+	DropConnection    bool              `json:"dropConnection,omitempty"`
+	ETag              bool              `json:"etag,omitempty"`
 }
 
-// LoadConfig reads and parses the configuration file
-func LoadConfig(filename string) (*Config, error) {
-	data, err := os.ReadFile(filename)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read config file: %w", err)
+// contentType returns the Content-Type the response is sent with: its own header,
+// else the server's default header, else the default for its kind of body
+func (r *Response) contentType(defaultHeaders map[string]string) string {
+	for _, headers := range []map[string]string{r.Headers, defaultHeaders} {
+		for key, value := range headers {
+			if strings.EqualFold(key, "Content-Type") {
+				return value
+			}
+		}
+	}
+	return defaultContentType(r)
+}
+
+// statusCode returns the status to send, defaulting to 200 when none is configured
+func (r *Response) statusCode() int {
+	if r.Status == 0 {
+		return http.StatusOK
+	}
+	return r.Status
+}
+
+// String identifies the route by method and path, e.g. "GET /api/users"
+func (r *Route) String() string {
+	return r.methodList() + " " + r.Path
+}
+
+// methods returns the HTTP methods the route is configured for, from methods
+// if it is set, otherwise method
+func (r *Route) methods() []string {
+	if len(r.Methods) > 0 {
+		return r.Methods
+	}
+	return []string{r.Method}
+}
+
+// methodList formats the route's methods for logs and listings, e.g. GET,HEAD
+func (r *Route) methodList() string {
+	return strings.Join(r.methods(), ",")
+}
+
+// isAnyMethod reports whether the route matches every HTTP method
+func (r *Route) isAnyMethod() bool {
+	return slices.ContainsFunc(r.methods(), func(m string) bool {
+		return m == "*" || m == "ANY"
+	})
+}
+
+// matchesMethod reports whether the route handles the given HTTP method
+func (r *Route) matchesMethod(method string) bool {
+	return r.isAnyMethod() || slices.Contains(r.methods(), method)
+}
+
+// firstResponse returns the first response the route sends
+func (r *Route) firstResponse() *Response {
+	if len(r.Responses) > 0 {
+		return &r.Responses[0]
+	}
+	if len(r.WeightedResponses) > 0 {
+		return &r.WeightedResponses[0].Response
+	}
+	if len(r.ResponseByHitCount) > 0 && r.ResponseByHitCount[0].covers(1) {
+		return &r.ResponseByHitCount[0].Response
 	}
+	return &r.Response
+}
+
+// firstStatus returns the status of the first response the route sends
+func (r *Route) firstStatus() int {
+	return r.firstResponse().statusCode()
+}
+
+// isEnabled reports whether the route should be served; routes are enabled unless set to false
+func (r *Route) isEnabled() bool {
+	return r.Enabled == nil || *r.Enabled
+}
+
+// hasMatchers reports whether the route constrains more than method and path
+func (r *Route) hasMatchers() bool {
+	return len(r.Query) > 0 || len(r.QueryPresent) > 0 || len(r.BodyMatch) > 0 || len(r.FormMatch) > 0 || len(r.CookieMatch) > 0 || r.RequireTLS != nil || r.ContentType != "" || r.MaxHits > 0
+}
+
+// eachResponse calls fn for every response the route can send: the base response,
+// any sequenced, weighted or hit count responses and any conditional responses
+func (r *Route) eachResponse(fn func(resp *Response) error) error {
+	if err := fn(&r.Response); err != nil {
+		return err
+	}
+	for j := range r.Responses {
+		if err := fn(&r.Responses[j]); err != nil {
+			return fmt.Errorf("responses[%d]: %w", j, err)
+		}
+	}
+	for j := range r.WeightedResponses {
+		if err := fn(&r.WeightedResponses[j].Response); err != nil {
+			return fmt.Errorf("weightedResponses[%d]: %w", j, err)
+		}
+	}
+	for j := range r.ResponseByHitCount {
+		if err := fn(&r.ResponseByHitCount[j].Response); err != nil {
+			return fmt.Errorf("responseByHitCount[%d]: %w", j, err)
+		}
+	}
+	for j := range r.When {
+		if err := fn(&r.When[j].Response); err != nil {
+			return fmt.Errorf("when[%d]: %w", j, err)
+		}
+	}
+	return nil
+}
+
+// stdinConfig is the config filename that reads the config from standard input
+const stdinConfig = "-"
 
+// LoadConfig reads and parses the configuration file, standard input when the
+// filename is "-", in which case relative paths resolve from the working directory,
+// or a directory of route files (see loadConfigDir)
+func LoadConfig(filename string) (*Config, error) {
 	var config Config
-	if err := json.Unmarshal(data, &config); err != nil {
-		return nil, fmt.Errorf("failed to parse config file: %w", err)
+	baseDir := filepath.Dir(filename)
+	if isConfigDir(filename) {
+		var err error
+		if config, err = loadConfigDir(filename); err != nil {
+			return nil, err
+		}
+		baseDir = filename
+	} else {
+		data, err := readConfigData(filename)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(data, &config); err != nil {
+			return nil, fmt.Errorf("failed to parse config file: %w", jsonErrorPosition(data, err))
+		}
 	}
 
 	// Validate config
@@ -50,35 +402,561 @@ func LoadConfig(filename string) (*Config, error) {
 		return nil, fmt.Errorf("invalid config: %w", err)
 	}
 
+	for i, group := range config.serverGroups() {
+		// Redirects go from a plain HTTP server to another server serving TLS
+		if group.Server.RedirectToHTTPS {
+			if group.Server.TLS != nil {
+				return nil, fmt.Errorf("invalid config: %sredirectToHttps can't be used on a server with tls", serverPrefix(&config, i))
+			}
+			if config.httpsPort() == 0 {
+				return nil, fmt.Errorf("invalid config: %sredirectToHttps requires another server in servers with tls", serverPrefix(&config, i))
+			}
+		}
+
+		// Resolve body files relative to the config file and make sure they exist
+		if err := resolveBodyFiles(group, baseDir); err != nil {
+			return nil, fmt.Errorf("invalid config: %s%w", serverPrefix(&config, i), err)
+		}
+
+		// Load request schemas, which may also be files relative to the config file
+		if err := loadRequestSchemas(group, baseDir); err != nil {
+			return nil, fmt.Errorf("invalid config: %s%w", serverPrefix(&config, i), err)
+		}
+	}
+
 	return &config, nil
 }
 
+// readConfigData reads a config file, or standard input for "-", and substitutes
+// ${VAR} references from the environment
+func readConfigData(filename string) ([]byte, error) {
+	var data []byte
+	var err error
+	if filename == stdinConfig {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(filename)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	data, err = expandEnv(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to expand config: %w", err)
+	}
+	return data, nil
+}
+
+// jsonErrorPosition adds the line and column to JSON syntax and type errors,
+// which otherwise only report a byte offset
+func jsonErrorPosition(data []byte, err error) error {
+	var offset int64
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &syntaxErr):
+		offset = syntaxErr.Offset
+	case errors.As(err, &typeErr):
+		offset = typeErr.Offset
+	default:
+		return err
+	}
+
+	// The offset counts the bytes read, so the offending character is the last of them
+	if offset > 0 {
+		offset--
+	}
+	offset = min(offset, int64(len(data)))
+	before := data[:offset]
+	line := bytes.Count(before, []byte("\n")) + 1
+	column := int(offset) - bytes.LastIndexByte(before, '\n')
+	return fmt.Errorf("config error at line %d, column %d: %w", line, column, err)
+}
+
+// resolveBodyFiles rewrites relative bodyFile paths to be relative to baseDir
+// and checks that every referenced file exists
+func resolveBodyFiles(config *Config, baseDir string) error {
+	for i := range config.Routes {
+		err := config.Routes[i].eachResponse(func(resp *Response) error {
+			return resolveBodyFile(resp, baseDir, config.Server.DefaultHeaders)
+		})
+		if err != nil {
+			return fmt.Errorf("route %d: %w", i, err)
+		}
+	}
+	if config.DefaultResponse != nil {
+		if err := resolveBodyFile(config.DefaultResponse, baseDir, config.Server.DefaultHeaders); err != nil {
+			return fmt.Errorf("defaultResponse: %w", err)
+		}
+	}
+	return nil
+}
+
+// resolveBodyFile resolves and checks the bodyFile of a single response
+// Files sent as JSON must hold valid JSON, so a broken fixture fails at startup
+func resolveBodyFile(resp *Response, baseDir string, defaultHeaders map[string]string) error {
+	if resp.BodyFile == "" {
+		return nil
+	}
+	if !filepath.IsAbs(resp.BodyFile) {
+		resp.BodyFile = filepath.Join(baseDir, resp.BodyFile)
+	}
+	if _, err := os.Stat(resp.BodyFile); err != nil {
+		return fmt.Errorf("bodyFile not found: %s", resp.BodyFile)
+	}
+	if isJSONContentType(resp.contentType(defaultHeaders)) {
+		data, err := os.ReadFile(resp.BodyFile)
+		if err != nil {
+			return fmt.Errorf("failed to read bodyFile: %w", err)
+		}
+		if !json.Valid(data) {
+			return fmt.Errorf("bodyFile %s is not valid JSON: set a Content-Type header if it isn't meant to be", resp.BodyFile)
+		}
+	}
+	return nil
+}
+
+// serverPrefix names the i-th server in error messages when the config lists several
+func serverPrefix(config *Config, i int) string {
+	if len(config.Servers) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("servers[%d]: ", i)
+}
+
+// validateServers validates each server of a multi-server config, which can't
+// also define a top-level server, routes or defaultResponse
+func validateServers(config *Config) error {
+	if !reflect.ValueOf(config.Server).IsZero() || len(config.Routes) > 0 || config.DefaultResponse != nil {
+		return fmt.Errorf("servers cannot be combined with a top-level server, routes or defaultResponse")
+	}
+
+	ports := make(map[int]int)
+	for i := range config.Servers {
+		group := &config.Servers[i]
+		if len(group.Servers) > 0 {
+			return fmt.Errorf("servers[%d]: servers cannot be nested", i)
+		}
+		if err := validateConfig(group); err != nil {
+			return fmt.Errorf("servers[%d]: %w", i, err)
+		}
+		if file := group.Server.LogFile; file != "" && file != config.logFile() {
+			return fmt.Errorf("servers[%d]: logFile %q differs from %q, every server logs to the same file", i, file, config.logFile())
+		}
+		if first, ok := ports[group.Server.Port]; ok {
+			return fmt.Errorf("servers[%d]: port %d is already used by servers[%d]", i, group.Server.Port, first)
+		}
+		ports[group.Server.Port] = i
+	}
+	return nil
+}
+
+// validMethods are the route methods a config can use
+var validMethods = map[string]bool{
+	"GET":    true,
+	"POST":   true,
+	"PUT":    true,
+	"DELETE": true,
+	"PATCH":  true,
+	"HEAD":   true,
+	"*":      true,
+	"ANY":    true,
+}
+
 // validateConfig performs basic validation on the configuration
 func validateConfig(config *Config) error {
+	if len(config.Servers) > 0 {
+		return validateServers(config)
+	}
+
 	if config.Server.Port <= 0 || config.Server.Port > 65535 {
 		return fmt.Errorf("invalid port number: %d", config.Server.Port)
 	}
 
-	validMethods := map[string]bool{
-		"GET":    true,
-		"POST":   true,
-		"PUT":    true,
-		"DELETE": true,
-		"PATCH":  true,
-		"HEAD":   true,
+	if host := config.Server.Host; host != "" && !validHost(host) {
+		return fmt.Errorf("invalid host %q: must be an IP address or hostname", host)
+	}
+
+	switch config.Server.LogFormat {
+	case "", logFormatText, logFormatJSON:
+	default:
+		return fmt.Errorf("invalid logFormat %q: must be %q or %q", config.Server.LogFormat, logFormatText, logFormatJSON)
+	}
+	if _, ok := logLevels[config.Server.LogLevel]; !ok && config.Server.LogLevel != "" {
+		return fmt.Errorf("invalid logLevel %q: must be %q, %q or %q", config.Server.LogLevel, logLevelDebug, logLevelInfo, logLevelError)
+	}
+	switch config.Server.DumpRequests {
+	case "", dumpAll, dumpUnmatched:
+	default:
+		return fmt.Errorf("invalid dumpRequests %q: must be %q or %q", config.Server.DumpRequests, dumpAll, dumpUnmatched)
+	}
+
+	if base := config.Server.BasePath; base != "" && (!strings.HasPrefix(base, "/") || strings.HasSuffix(base, "/")) {
+		return fmt.Errorf("invalid basePath %q: must start with / and not end with /", base)
+	}
+
+	if cors := config.Server.CORS; cors != nil && len(cors.AllowedOrigins) == 0 {
+		return fmt.Errorf("cors: allowedOrigins cannot be empty")
+	}
+
+	if t := config.Server.TLS; t != nil {
+		if (t.CertFile == "") != (t.KeyFile == "") {
+			return fmt.Errorf("tls: certFile and keyFile must be set together")
+		}
+		if t.CertFile == "" && !t.SelfSigned {
+			return fmt.Errorf("tls: certFile and keyFile are required unless selfSigned is true")
+		}
+	}
+
+	if err := validateRateLimit(config.Server.RateLimit); err != nil {
+		return fmt.Errorf("server: %w", err)
+	}
+
+	if config.Server.MaxBodyBytes < 0 {
+		return fmt.Errorf("server: maxBodyBytes cannot be negative")
+	}
+	if config.Server.MaxConcurrent < 0 {
+		return fmt.Errorf("server: maxConcurrent cannot be negative")
+	}
+	if config.Server.QueueWhenBusy && config.Server.MaxConcurrent == 0 {
+		return fmt.Errorf("server: queueWhenBusy requires maxConcurrent")
+	}
+	if config.Server.StartupDelayMs < 0 {
+		return fmt.Errorf("server: startupDelayMs cannot be negative")
+	}
+	if t := config.Server.Timeouts; t != nil && (t.ReadMs < 0 || t.WriteMs < 0 || t.IdleMs < 0) {
+		return fmt.Errorf("server: timeouts cannot be negative")
+	}
+
+	if h := config.Server.Health; h != nil && h.Status != 0 && (h.Status < 100 || h.Status > 599) {
+		return fmt.Errorf("server: invalid health status: %d", h.Status)
+	}
+
+	for _, name := range config.Server.Middleware {
+		if _, ok := builtinMiddleware[name]; !ok {
+			return fmt.Errorf("server: unknown middleware %q: must be one of %s", name, middlewareNames())
+		}
+	}
+
+	if config.DefaultResponse != nil {
+		if err := validateResponse(config.DefaultResponse); err != nil {
+			return fmt.Errorf("defaultResponse: %w", err)
+		}
 	}
 
 	for i, route := range config.Routes {
 		if route.Path == "" {
 			return fmt.Errorf("route %d: path cannot be empty", i)
 		}
-		if !validMethods[route.Method] {
-			return fmt.Errorf("route %d: invalid method %s", i, route.Method)
+		if strings.HasPrefix(route.Path, regexPrefix) {
+			if _, err := compilePathRegex(route.Path); err != nil {
+				return fmt.Errorf("route %d: invalid path regex: %w", i, err)
+			}
+		} else if err := validatePathParams(route.Path); err != nil {
+			return fmt.Errorf("route %d: %w", i, err)
+		}
+		if route.Method != "" && len(route.Methods) > 0 {
+			return fmt.Errorf("route %d: method and methods cannot both be set", i)
+		}
+		if route.Methods != nil && len(route.Methods) == 0 {
+			return fmt.Errorf("route %d: methods must have at least one entry", i)
+		}
+		for _, method := range route.methods() {
+			if !validMethods[method] {
+				return fmt.Errorf("route %d: invalid method %s", i, method)
+			}
+		}
+		switch route.AuthType {
+		case "", authTypeHeader:
+			if route.RequiresAuth && route.AuthHeader == "" {
+				return fmt.Errorf("route %d: authHeader required when requiresAuth is true", i)
+			}
+		case authTypeBasic:
+			if route.RequiresAuth && (route.Username == "" || route.Password == "") {
+				return fmt.Errorf("route %d: username and password required for basic auth", i)
+			}
+		default:
+			return fmt.Errorf("route %d: invalid authType %q: must be %q or %q", i, route.AuthType, authTypeHeader, authTypeBasic)
+		}
+		if route.ProxyTo != "" {
+			if u, err := url.Parse(route.ProxyTo); err != nil || u.Scheme == "" || u.Host == "" {
+				return fmt.Errorf("route %d: proxyTo must be an absolute URL: %s", i, route.ProxyTo)
+			}
+		}
+		if err := validateRateLimit(route.RateLimit); err != nil {
+			return fmt.Errorf("route %d: %w", i, err)
+		}
+		for j, cond := range route.When {
+			if cond.Header == "" {
+				return fmt.Errorf("route %d: when[%d]: header cannot be empty", i, j)
+			}
+		}
+		for key, source := range route.Capture {
+			if key == "" {
+				return fmt.Errorf("route %d: capture: key cannot be empty", i)
+			}
+			if _, _, err := parseMergeSource(source); err != nil {
+				return fmt.Errorf("route %d: capture %q: %w", i, key, err)
+			}
+		}
+		if route.MaxHits < 0 {
+			return fmt.Errorf("route %d: maxHits cannot be negative", i)
+		}
+		if route.IdempotencyTTLMs < 0 {
+			return fmt.Errorf("route %d: idempotencyTtlMs cannot be negative", i)
+		}
+		if route.IdempotencyTTLMs > 0 && !route.Idempotent {
+			return fmt.Errorf("route %d: idempotencyTtlMs requires idempotent", i)
+		}
+		if route.WeightedResponses != nil {
+			if len(route.WeightedResponses) == 0 {
+				return fmt.Errorf("route %d: weightedResponses must have at least one entry", i)
+			}
+			if len(route.Responses) > 0 {
+				return fmt.Errorf("route %d: weightedResponses cannot be combined with responses", i)
+			}
+		}
+		for j, weighted := range route.WeightedResponses {
+			if weighted.Weight <= 0 {
+				return fmt.Errorf("route %d: weightedResponses[%d]: weight must be positive", i, j)
+			}
+		}
+		if route.ResponseByHitCount != nil {
+			if len(route.ResponseByHitCount) == 0 {
+				return fmt.Errorf("route %d: responseByHitCount must have at least one entry", i)
+			}
+			if len(route.Responses) > 0 || len(route.WeightedResponses) > 0 {
+				return fmt.Errorf("route %d: responseByHitCount cannot be combined with responses or weightedResponses", i)
+			}
+		}
+		if err := validateHitRanges(route.ResponseByHitCount); err != nil {
+			return fmt.Errorf("route %d: %w", i, err)
+		}
+		if err := route.eachResponse(validateResponse); err != nil {
+			return fmt.Errorf("route %d: %w", i, err)
+		}
+	}
+
+	return checkDuplicateRoutes(config.Routes)
+}
+
+// checkDuplicateRoutes reports routes that share a method and path, where paths
+// differing only in parameter names (e.g. /users/{id} and /users/{uid}) are the same
+// Routes that differ in their query, body or form matchers are not duplicates
+func checkDuplicateRoutes(routes []Route) error {
+	seen := make(map[string]int)
+	var duplicates []string
+	for i, route := range routes {
+		// Disabled routes are never matched, and routes with maxHits fall through to
+		// the next match once used up, so neither can clash
+		if !route.isEnabled() || route.MaxHits > 0 {
+			continue
+		}
+		// Routes with several methods clash with any route sharing one of them
+		for _, method := range route.methods() {
+			key := routeKey(&route, method)
+			if first, ok := seen[key]; ok {
+				duplicates = append(duplicates, fmt.Sprintf("route %d and route %d (%s %s)", first, i, method, route.Path))
+				continue
+			}
+			seen[key] = i
 		}
-		if route.RequiresAuth && route.AuthHeader == "" {
-			return fmt.Errorf("route %d: authHeader required when requiresAuth is true", i)
+	}
+
+	if len(duplicates) > 0 {
+		return fmt.Errorf("duplicate routes: %s", strings.Join(duplicates, "; "))
+	}
+	return nil
+}
+
+// routeKey identifies a route by one of its methods, its normalized path and matchers
+func routeKey(route *Route, method string) string {
+	segments := strings.Split(route.Path, "/")
+	for i, segment := range segments {
+		if _, typ, ok := parseParam(segment); ok {
+			segments[i] = "{" + typ + "}"
+		}
+	}
+
+	// Marshalling sorts map keys, giving a stable representation of the matchers
+	present := slices.Sorted(slices.Values(route.QueryPresent))
+	matchers, _ := json.Marshal([]interface{}{route.Query, present, route.BodyMatch, route.FormMatch, route.CookieMatch, route.RequireTLS, strings.ToLower(route.ContentType)})
+	return method + " " + strings.Join(segments, "/") + " " + string(matchers)
+}
+
+// validateHitRanges checks that hit count ranges start at 1 or later and are
+// listed in ascending order without overlapping
+func validateHitRanges(ranges []HitRange) error {
+	for j, hr := range ranges {
+		if hr.From < 1 {
+			return fmt.Errorf("responseByHitCount[%d]: from must be at least 1", j)
+		}
+		if hr.To != 0 && hr.To < hr.From {
+			return fmt.Errorf("responseByHitCount[%d]: to cannot be less than from", j)
+		}
+		if j > 0 {
+			prev := ranges[j-1]
+			if prev.To == 0 || hr.From <= prev.To {
+				return fmt.Errorf("responseByHitCount[%d]: overlaps responseByHitCount[%d], ranges must be in ascending order", j, j-1)
+			}
+		}
+	}
+	return nil
+}
+
+// validateResponse checks a single response configuration
+func validateResponse(resp *Response) error {
+	// Any code in range is allowed, including unregistered ones such as 299
+	if resp.Status != 0 && (resp.Status < 100 || resp.Status > 599) {
+		return fmt.Errorf("invalid status %d: must be between 100 and 599", resp.Status)
+	}
+	if resp.BodyRaw != "" && resp.Body != nil {
+		return fmt.Errorf("body and bodyRaw cannot both be set")
+	}
+	for _, name := range resp.RemoveHeaders {
+		if strings.TrimSpace(name) == "" {
+			return fmt.Errorf("removeHeaders: header name cannot be empty")
+		}
+	}
+	// Catch bodies that would fail to encode now rather than when a request hits them
+	if resp.Body != nil && resp.BodyFile == "" {
+		if _, err := json.Marshal(resp.Body); err != nil {
+			return fmt.Errorf("body cannot be encoded as JSON: %w", err)
+		}
+	}
+	if resp.BodyTemplate != "" {
+		if resp.Body != nil || resp.BodyRaw != "" {
+			return fmt.Errorf("bodyTemplate cannot be combined with body or bodyRaw")
+		}
+		if _, err := parseBodyTemplate(resp.BodyTemplate); err != nil {
+			return fmt.Errorf("invalid bodyTemplate: %w", err)
+		}
+	}
+	if len(resp.MergeFromRequest) > 0 {
+		if _, ok := resp.Body.(map[string]interface{}); !ok {
+			return fmt.Errorf("mergeFromRequest requires body to be a JSON object")
+		}
+		for field, source := range resp.MergeFromRequest {
+			if field == "" {
+				return fmt.Errorf("mergeFromRequest: field cannot be empty")
+			}
+			if _, _, err := parseMergeSource(source); err != nil {
+				return fmt.Errorf("mergeFromRequest %q: %w", field, err)
+			}
+		}
+	}
+	if resp.BodyBase64 != "" {
+		if resp.Body != nil || resp.BodyRaw != "" || resp.BodyTemplate != "" || resp.BodyFile != "" {
+			return fmt.Errorf("bodyBase64 cannot be combined with body, bodyRaw, bodyTemplate or bodyFile")
+		}
+		if _, err := base64.StdEncoding.DecodeString(resp.BodyBase64); err != nil {
+			return fmt.Errorf("invalid bodyBase64: %w", err)
+		}
+	}
+	if resp.BodyXML != nil {
+		if resp.Body != nil || resp.BodyRaw != "" || resp.BodyTemplate != "" || resp.BodyFile != "" || resp.BodyBase64 != "" {
+			return fmt.Errorf("bodyXml cannot be combined with body, bodyRaw, bodyBase64, bodyTemplate or bodyFile")
+		}
+		if err := validateXMLBody(resp.BodyXML); err != nil {
+			return fmt.Errorf("invalid bodyXml: %w", err)
+		}
+	}
+	if resp.Stream != nil && (resp.Body != nil || resp.BodyRaw != "" || resp.BodyTemplate != "" || resp.BodyFile != "" || resp.BodyBase64 != "" || resp.BodyXML != nil) {
+		return fmt.Errorf("stream cannot be combined with body, bodyRaw, bodyBase64, bodyXml, bodyTemplate or bodyFile")
+	}
+	if resp.StreamIntervalMs < 0 {
+		return fmt.Errorf("streamIntervalMs cannot be negative")
+	}
+	if resp.SSE != nil {
+		if resp.Stream != nil || resp.Body != nil || resp.BodyRaw != "" || resp.BodyTemplate != "" || resp.BodyFile != "" || resp.BodyBase64 != "" || resp.BodyXML != nil {
+			return fmt.Errorf("sse cannot be combined with stream or the body fields")
+		}
+		if len(resp.SSE) == 0 {
+			return fmt.Errorf("sse must have at least one event")
+		}
+		for i, event := range resp.SSE {
+			if strings.ContainsAny(event.ID+event.Event, "\r\n") {
+				return fmt.Errorf("sse[%d]: id and event cannot contain newlines", i)
+			}
+			if event.Retry < 0 {
+				return fmt.Errorf("sse[%d]: retry cannot be negative", i)
+			}
+		}
+	}
+	if resp.SSEIntervalMs < 0 {
+		return fmt.Errorf("sseIntervalMs cannot be negative")
+	}
+	if resp.SSELoop && resp.SSEIntervalMs == 0 {
+		return fmt.Errorf("sseLoop requires a positive sseIntervalMs")
+	}
+	if resp.DelayMs < 0 {
+		return fmt.Errorf("delayMs cannot be negative")
+	}
+	if resp.DelayMinMs < 0 || resp.DelayMaxMs < 0 {
+		return fmt.Errorf("delayMinMs and delayMaxMs cannot be negative")
+	}
+	if resp.DelayMinMs > resp.DelayMaxMs {
+		return fmt.Errorf("delayMinMs (%d) cannot be greater than delayMaxMs (%d)", resp.DelayMinMs, resp.DelayMaxMs)
+	}
+	if resp.DelayMeanMs < 0 || resp.DelayStdDevMs < 0 {
+		return fmt.Errorf("delayMeanMs and delayStdDevMs cannot be negative")
+	}
+	switch resp.DelayDistribution {
+	case "":
+		if resp.DelayMeanMs > 0 || resp.DelayStdDevMs > 0 {
+			return fmt.Errorf("delayMeanMs and delayStdDevMs require a delayDistribution of %q or %q", delayNormal, delayExponential)
+		}
+	case delayUniform:
+		if resp.DelayMaxMs == 0 {
+			return fmt.Errorf("delayDistribution %q requires delayMinMs and delayMaxMs", delayUniform)
+		}
+	case delayNormal:
+		if resp.DelayMeanMs == 0 && resp.DelayStdDevMs == 0 {
+			return fmt.Errorf("delayDistribution %q requires delayMeanMs and delayStdDevMs", delayNormal)
+		}
+	case delayExponential:
+		if resp.DelayMeanMs == 0 {
+			return fmt.Errorf("delayDistribution %q requires delayMeanMs", delayExponential)
+		}
+	default:
+		return fmt.Errorf("invalid delayDistribution %q: must be %q, %q or %q", resp.DelayDistribution, delayUniform, delayNormal, delayExponential)
+	}
+	if resp.DripMs < 0 || resp.DripChunkSize < 0 {
+		return fmt.Errorf("dripMs and dripChunkSize cannot be negative")
+	}
+	if resp.FailureRate < 0 || resp.FailureRate > 1 {
+		return fmt.Errorf("failureRate must be between 0 and 1")
+	}
+	if resp.FailureStatus != 0 && (resp.FailureStatus < 100 || resp.FailureStatus > 599) {
+		return fmt.Errorf("invalid failureStatus: %d", resp.FailureStatus)
+	}
+	for i, spec := range resp.SetCookies {
+		if err := spec.cookie().Valid(); err != nil {
+			return fmt.Errorf("setCookies[%d]: %w", i, err)
 		}
 	}
+	return nil
+}
+
+// hostnamePattern matches DNS hostnames such as localhost or mock.internal
+var hostnamePattern = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9-]*[A-Za-z0-9])?(\.[A-Za-z0-9]([A-Za-z0-9-]*[A-Za-z0-9])?)*$`)
+
+// validHost reports whether a bind host is an IP address or a plausible hostname
+func validHost(host string) bool {
+	return net.ParseIP(host) != nil || hostnamePattern.MatchString(host)
+}
 
+// validateRateLimit checks an optional rate limit configuration
+func validateRateLimit(limit *RateLimitConfig) error {
+	if limit == nil {
+		return nil
+	}
+	if limit.RequestsPerSecond <= 0 {
+		return fmt.Errorf("rateLimit: requestsPerSecond must be positive")
+	}
+	if limit.Burst < 0 {
+		return fmt.Errorf("rateLimit: burst cannot be negative")
+	}
 	return nil
 }
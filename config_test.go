@@ -0,0 +1,176 @@
+package main
+
+import (
+	"math"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// loadConfigError loads the config, expecting it to be rejected, and returns the error
+func loadConfigError(t *testing.T, config string) error {
+	t.Helper()
+	filename := filepath.Join(t.TempDir(), "config.json")
+	writeTestFile(t, filename, config)
+	_, err := LoadConfig(filename)
+	if err == nil {
+		t.Fatalf("LoadConfig accepted %s", config)
+	}
+	return err
+}
+
+func TestRequestSchemaRejectsInvalidSchemas(t *testing.T) {
+	for _, schema := range []string{
+		`{"type": "strin"}`,
+		`{"minLength": "one"}`,
+		`{"pattern": "("}`,
+		`{"$ref": "#/$defs/missing"}`,
+	} {
+		err := loadConfigError(t, `{"server": {"port": 8080}, "routes": [
+			{"method": "POST", "path": "/users", "requestSchema": `+schema+`, "response": {"status": 201}}
+		]}`)
+		if !strings.Contains(err.Error(), "route 0: invalid requestSchema") {
+			t.Errorf("schema %s: error %q, want route 0's requestSchema reported as invalid", schema, err)
+		}
+	}
+}
+
+func TestBodyFileMustBeJSONUnlessTyped(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "users.json"), `[{"name": "Ada"},]`)
+	writeTestFile(t, filepath.Join(dir, "users.csv"), "name\nAda\n")
+
+	err := loadConfigError(t, `{"server": {"port": 8080}, "routes": [
+		{"method": "GET", "path": "/users", "response": {"status": 200, "bodyFile": "`+filepath.Join(dir, "users.json")+`"}}
+	]}`)
+	if !strings.Contains(err.Error(), "route 0: bodyFile") || !strings.Contains(err.Error(), "not valid JSON") {
+		t.Errorf("error %q, want route 0's bodyFile reported as invalid JSON", err)
+	}
+
+	loadTestConfig(t, `{"server": {"port": 8080}, "routes": [
+		{"method": "GET", "path": "/users", "response": {"status": 200, "headers": {"content-type": "text/csv"}, "bodyFile": "`+filepath.Join(dir, "users.csv")+`"}}
+	]}`)
+}
+
+func TestDuplicateRoutes(t *testing.T) {
+	tests := map[string]string{
+		"exact duplicate": `{"method": "GET", "path": "/users/{id}", "response": {"status": 200}},
+			{"method": "GET", "path": "/users/{id}", "response": {"status": 404}}`,
+		"parameter names differ": `{"method": "GET", "path": "/users/{id}", "response": {"status": 200}},
+			{"method": "GET", "path": "/users/{uid}", "response": {"status": 404}}`,
+		"shared method": `{"methods": ["GET", "HEAD"], "path": "/users", "response": {"status": 200}},
+			{"method": "HEAD", "path": "/users", "response": {"status": 404}}`,
+	}
+	for name, routes := range tests {
+		err := loadConfigError(t, `{"server": {"port": 8080}, "routes": [`+routes+`]}`)
+		if !strings.Contains(err.Error(), "duplicate routes: route 0 and route 1") {
+			t.Errorf("%s: error %q, want routes 0 and 1 reported", name, err)
+		}
+	}
+
+	loadTestConfig(t, `{"server": {"port": 8080}, "routes": [
+		{"method": "GET", "path": "/users/{id}", "response": {"status": 200}},
+		{"method": "GET", "path": "/users/{id:int}", "response": {"status": 200}},
+		{"method": "POST", "path": "/users/{id}", "response": {"status": 200}},
+		{"method": "GET", "path": "/users/{id}", "query": {"v": "2"}, "response": {"status": 200}}
+	]}`)
+}
+
+func TestWeightedResponsesValidation(t *testing.T) {
+	tests := map[string]string{
+		`[{"weight": 0, "response": {"status": 200}}]`:                                              "weight",
+		`[{"weight": 2, "response": {"status": 200}}, {"weight": -1, "response": {"status": 500}}]`: "weight",
+	}
+	for weighted, want := range tests {
+		err := loadConfigError(t, `{"server": {"port": 8080}, "routes": [
+			{"method": "GET", "path": "/flaky", "weightedResponses": `+weighted+`}
+		]}`)
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: error %q, want it to mention %s", weighted, err, want)
+		}
+	}
+}
+
+func TestMaxBodyBytesMustNotBeNegative(t *testing.T) {
+	err := loadConfigError(t, `{"server": {"port": 8080, "maxBodyBytes": -1}, "routes": []}`)
+	if !strings.Contains(err.Error(), "maxBodyBytes") {
+		t.Errorf("error %q, want it to mention maxBodyBytes", err)
+	}
+}
+
+func TestUnknownPathParamType(t *testing.T) {
+	err := loadConfigError(t, `{"server": {"port": 8080}, "routes": [
+		{"method": "GET", "path": "/users/{id:number}", "response": {"status": 200}}
+	]}`)
+	if !strings.Contains(err.Error(), `unknown parameter type "number"`) {
+		t.Errorf("error %q, want the unknown type reported", err)
+	}
+}
+
+func TestMalformedJSONReportsPosition(t *testing.T) {
+	tests := []struct {
+		name, config, want string
+	}{
+		{"trailing comma", "{\n  \"server\": {\"port\": 8080},\n  \"routes\": [\n    {\"method\": \"GET\", \"path\": \"/users\", \"response\": {\"status\": 200}},\n  ]\n}", "config error at line 5, column 3"},
+		{"wrong type", "{\n  \"server\": {\n    \"port\": \"8080\"\n  }\n}", "config error at line 3"},
+	}
+	for _, tt := range tests {
+		if err := loadConfigError(t, tt.config); !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: error %q, want it to contain %q", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestRedirectToHTTPSRequiresTLSServer(t *testing.T) {
+	err := loadConfigError(t, `{"servers": [
+		{"server": {"port": 8080, "redirectToHttps": true}, "routes": []},
+		{"server": {"port": 8081}, "routes": []}
+	]}`)
+	if !strings.Contains(err.Error(), "servers[0]: redirectToHttps requires another server in servers with tls") {
+		t.Errorf("error %q, want the missing TLS server reported", err)
+	}
+}
+
+func TestHitRangeValidation(t *testing.T) {
+	tests := map[string]string{
+		`[{"from": 0, "response": {"status": 200}}]`:                                                    "from must be at least 1",
+		`[{"from": 3, "to": 2, "response": {"status": 200}}]`:                                           "to cannot be less than from",
+		`[{"from": 1, "to": 3, "response": {"status": 503}}, {"from": 3, "response": {"status": 200}}]`: "responseByHitCount[1]",
+	}
+	for ranges, want := range tests {
+		err := loadConfigError(t, `{"server": {"port": 8080}, "routes": [
+			{"method": "GET", "path": "/status", "responseByHitCount": `+ranges+`, "response": {"status": 200}}
+		]}`)
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: error %q, want it to mention %s", ranges, err, want)
+		}
+	}
+}
+
+func TestBodyMustEncodeAsJSON(t *testing.T) {
+	config := &Config{
+		Server: ServerConfig{Port: 8080},
+		Routes: []Route{
+			{Method: "GET", Path: "/ok", Response: Response{Status: 200, Body: map[string]interface{}{"n": 1}}},
+			{Method: "GET", Path: "/nan", Response: Response{Status: 200, Body: map[string]interface{}{"n": math.NaN()}}},
+		},
+	}
+	err := validateConfig(config)
+	if err == nil {
+		t.Fatal("validateConfig accepted a body that can't be encoded as JSON")
+	}
+	if !strings.Contains(err.Error(), "route 1: body cannot be encoded as JSON") {
+		t.Errorf("error %q, want route 1's body reported", err)
+	}
+}
+
+func TestStatusMustBeInRange(t *testing.T) {
+	for _, status := range []string{"99", "600"} {
+		err := loadConfigError(t, `{"server": {"port": 8080}, "routes": [
+			{"method": "GET", "path": "/users", "response": {"status": `+status+`}}
+		]}`)
+		if !strings.Contains(err.Error(), "route 0: invalid status "+status) {
+			t.Errorf("status %s: error %q, want route 0's status reported", status, err)
+		}
+	}
+}
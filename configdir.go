@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// serverConfigFile is the file in a config directory holding the server settings
+const serverConfigFile = "server.json"
+
+// isConfigDir reports whether the config filename names a directory
+func isConfigDir(filename string) bool {
+	if filename == stdinConfig {
+		return false
+	}
+	info, err := os.Stat(filename)
+	return err == nil && info.IsDir()
+}
+
+// routeFiles lists the route files of a config directory in name order: every
+// *.json file except server.json
+func routeFiles(dir string) ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	routes := files[:0]
+	for _, file := range files {
+		if filepath.Base(file) != serverConfigFile {
+			routes = append(routes, file)
+		}
+	}
+	return routes, nil
+}
+
+// loadConfigDir reads a config directory: server.json for the server settings,
+// fallback response and any routes, then every other *.json file for more routes,
+// each holding a single route or a list of them. Routes are appended in file
+// name order, so route numbers in errors count across the whole directory
+func loadConfigDir(dir string) (Config, error) {
+	var config Config
+	data, err := readConfigData(filepath.Join(dir, serverConfigFile))
+	if err != nil {
+		return config, err
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return config, fmt.Errorf("failed to parse %s: %w", serverConfigFile, jsonErrorPosition(data, err))
+	}
+	if len(config.Servers) > 0 {
+		return config, fmt.Errorf("%s: servers can't be used in a config directory", serverConfigFile)
+	}
+
+	files, err := routeFiles(dir)
+	if err != nil {
+		return config, fmt.Errorf("failed to list route files: %w", err)
+	}
+	for _, file := range files {
+		data, err := readConfigData(file)
+		if err != nil {
+			return config, err
+		}
+
+		// A file holds either a list of routes or a single route
+		var routes []Route
+		if bytes.HasPrefix(bytes.TrimSpace(data), []byte("[")) {
+			err = json.Unmarshal(data, &routes)
+		} else {
+			routes = make([]Route, 1)
+			err = json.Unmarshal(data, &routes[0])
+		}
+		if err != nil {
+			return config, fmt.Errorf("failed to parse %s: %w", filepath.Base(file), jsonErrorPosition(data, err))
+		}
+		config.Routes = append(config.Routes, routes...)
+	}
+	return config, nil
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// contractRoute describes what a route accepts and what it sends back, for
+// /_contract consumers that generate requests satisfying the mock
+type contractRoute struct {
+	Methods    []string           `json:"methods"`
+	Path       string             `json:"path"`
+	PathParams []contractParam    `json:"pathParams,omitempty"`
+	Enabled    bool               `json:"enabled"`
+	Priority   int                `json:"priority,omitempty"`
+	Stateful   bool               `json:"stateful,omitempty"`
+	ProxyTo    string             `json:"proxyTo,omitempty"`
+	Request    contractRequest    `json:"request"`
+	Responses  []contractResponse `json:"responses"`
+}
+
+// contractParam is a path parameter and its type, if it has one
+type contractParam struct {
+	Name string `json:"name"`
+	Type string `json:"type,omitempty"`
+}
+
+// contractRequest lists the constraints a request must meet to match a route
+type contractRequest struct {
+	Auth         *contractAuth          `json:"auth,omitempty"`
+	Query        map[string]string      `json:"query,omitempty"`
+	QueryPresent []string               `json:"queryPresent,omitempty"`
+	Cookies      map[string]string      `json:"cookies,omitempty"`
+	ContentType  string                 `json:"contentType,omitempty"`
+	Body         map[string]interface{} `json:"body,omitempty"`
+	Form         map[string]string      `json:"form,omitempty"`
+	Schema       interface{}            `json:"schema,omitempty"`
+	RequireTLS   *bool                  `json:"requireTls,omitempty"`
+}
+
+// contractAuth describes the kind of credentials a route requires and the header
+// they go in, but never the credentials themselves
+type contractAuth struct {
+	Type   string `json:"type"`
+	Header string `json:"header"`
+}
+
+// contractResponse is one response a route can send, with what selects it
+type contractResponse struct {
+	Status      int                    `json:"status"`
+	When        *contractCondition     `json:"when,omitempty"`
+	Sequence    int                    `json:"sequence,omitempty"`
+	Weight      int                    `json:"weight,omitempty"`
+	Hits        *contractHits          `json:"hits,omitempty"`
+	ContentType string                 `json:"contentType"`
+	Headers     map[string]string      `json:"headers,omitempty"`
+	Schema      map[string]interface{} `json:"schema,omitempty"`
+}
+
+// contractCondition is the request header that selects a conditional response
+type contractCondition struct {
+	Header string `json:"header"`
+	Value  string `json:"value"`
+}
+
+// contractHits is the range of requests a responseByHitCount entry covers
+type contractHits struct {
+	From int `json:"from"`
+	To   int `json:"to,omitempty"`
+}
+
+// contractHandler describes every route's request constraints and responses,
+// reflecting any reloads
+func (h *MockHandler) contractHandler(w http.ResponseWriter, r *http.Request) {
+	h.mu.RLock()
+	routes := make([]contractRoute, 0, len(h.routes))
+	for i := range h.routes {
+		routes = append(routes, h.contractRoute(&h.routes[i]))
+	}
+	h.mu.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	enc.Encode(map[string]interface{}{"routes": routes})
+}
+
+// contractRoute builds the contract for a single route
+func (h *MockHandler) contractRoute(route *Route) contractRoute {
+	c := contractRoute{
+		Methods:    route.methods(),
+		Path:       h.publicPath(route.Path),
+		PathParams: contractParams(route.Path),
+		Enabled:    route.isEnabled(),
+		Priority:   route.Priority,
+		Stateful:   route.Stateful,
+		ProxyTo:    route.ProxyTo,
+		Request: contractRequest{
+			Query:        route.Query,
+			QueryPresent: route.QueryPresent,
+			Cookies:      route.CookieMatch,
+			ContentType:  route.ContentType,
+			Body:         route.BodyMatch,
+			Form:         route.FormMatch,
+			Schema:       route.RequestSchema,
+			RequireTLS:   route.RequireTLS,
+		},
+	}
+
+	if route.RequiresAuth {
+		auth := &contractAuth{Type: authTypeHeader, Header: route.AuthHeader}
+		if route.AuthType == authTypeBasic {
+			auth = &contractAuth{Type: authTypeBasic, Header: "Authorization"}
+		}
+		c.Request.Auth = auth
+	}
+
+	// Conditional responses are checked first, then whichever way the route picks
+	// its other responses, with the route's response last when it can still be sent
+	for i := range route.When {
+		cond := &route.When[i]
+		resp := h.contractResponse(&cond.Response)
+		resp.When = &contractCondition{Header: cond.Header, Value: cond.Value}
+		c.Responses = append(c.Responses, resp)
+	}
+	switch {
+	case len(route.Responses) > 0:
+		for i := range route.Responses {
+			resp := h.contractResponse(&route.Responses[i])
+			resp.Sequence = i + 1
+			c.Responses = append(c.Responses, resp)
+		}
+	case len(route.WeightedResponses) > 0:
+		for i := range route.WeightedResponses {
+			resp := h.contractResponse(&route.WeightedResponses[i].Response)
+			resp.Weight = route.WeightedResponses[i].Weight
+			c.Responses = append(c.Responses, resp)
+		}
+	default:
+		for i := range route.ResponseByHitCount {
+			hr := &route.ResponseByHitCount[i]
+			resp := h.contractResponse(&hr.Response)
+			resp.Hits = &contractHits{From: hr.From, To: hr.To}
+			c.Responses = append(c.Responses, resp)
+		}
+		c.Responses = append(c.Responses, h.contractResponse(&route.Response))
+	}
+	return c
+}
+
+// contractResponse describes a response's status, headers, Content-Type and, for
+// JSON bodies, a schema inferred from the configured body
+func (h *MockHandler) contractResponse(resp *Response) contractResponse {
+	headers := make(map[string]string, len(h.server.DefaultHeaders)+len(resp.Headers))
+	for key, value := range h.server.DefaultHeaders {
+		headers[http.CanonicalHeaderKey(key)] = value
+	}
+	for key, value := range resp.Headers {
+		headers[http.CanonicalHeaderKey(key)] = value
+	}
+	contentType, ok := headers["Content-Type"]
+	if !ok {
+		contentType = defaultContentType(resp)
+	}
+	delete(headers, "Content-Type")
+	if len(headers) == 0 {
+		headers = nil
+	}
+
+	c := contractResponse{Status: resp.statusCode(), ContentType: contentType, Headers: headers}
+	if resp.Body != nil && resp.BodyFile == "" {
+		c.Schema = inferSchema(resp.Body)
+	}
+	return c
+}
+
+// contractParams lists a route path's parameters in order, including the *
+// parameter of a trailing wildcard. Regex paths have none
+func contractParams(path string) []contractParam {
+	if strings.HasPrefix(path, regexPrefix) {
+		return nil
+	}
+	var params []contractParam
+	for _, segment := range strings.Split(path, "/") {
+		if name, typ, ok := parseParam(segment); ok {
+			params = append(params, contractParam{Name: name, Type: typ})
+		} else if segment == "*" {
+			params = append(params, contractParam{Name: "*"})
+		}
+	}
+	return params
+}
+
+// inferSchema describes a JSON value as a JSON Schema: its type, the properties of
+// objects, all of which are required, and the items of arrays, taken from the first
+func inferSchema(value interface{}) map[string]interface{} {
+	schema := map[string]interface{}{"type": jsonType(value)}
+	switch v := value.(type) {
+	case map[string]interface{}:
+		props := make(map[string]interface{}, len(v))
+		required := make([]string, 0, len(v))
+		for key, item := range v {
+			props[key] = inferSchema(item)
+			required = append(required, key)
+		}
+		sort.Strings(required)
+		schema["properties"] = props
+		if len(required) > 0 {
+			schema["required"] = required
+		}
+	case []interface{}:
+		if len(v) > 0 {
+			schema["items"] = inferSchema(v[0])
+		}
+	case float64:
+		if v == math.Trunc(v) {
+			schema["type"] = "integer"
+		}
+	}
+	return schema
+}
+
+// jsonType names the JSON type of a decoded value
+func jsonType(value interface{}) string {
+	switch value.(type) {
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	case string:
+		return "string"
+	case float64:
+		return "number"
+	case bool:
+		return "boolean"
+	case nil:
+		return "null"
+	}
+	return fmt.Sprintf("%T", value)
+}
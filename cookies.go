@@ -0,0 +1,19 @@
+package main
+
+import "net/http"
+
+// cookie converts the spec to an http.Cookie
+func (c CookieSpec) cookie() *http.Cookie {
+	return &http.Cookie{Name: c.Name, Value: c.Value, Path: c.Path, MaxAge: c.MaxAge}
+}
+
+// cookiesMatch checks that every expected cookie is present with the given value
+func cookiesMatch(expected map[string]string, r *http.Request) bool {
+	for name, value := range expected {
+		cookie, err := r.Cookie(name)
+		if err != nil || cookie.Value != value {
+			return false
+		}
+	}
+	return true
+}
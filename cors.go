@@ -0,0 +1,63 @@
+package main
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// defaultCORSMethods are advertised in preflight responses when no methods are configured
+var defaultCORSMethods = []string{"GET", "POST", "PUT", "DELETE", "PATCH", "HEAD"}
+
+// corsMiddleware adds Access-Control-Allow-* headers for allowed origins
+// and answers OPTIONS preflight requests with a 204
+func corsMiddleware(cors *CORSConfig, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		allowed := allowedOrigin(cors.AllowedOrigins, origin)
+		if allowed != "" {
+			w.Header().Set("Access-Control-Allow-Origin", allowed)
+			if allowed != "*" {
+				w.Header().Add("Vary", "Origin")
+			}
+		}
+
+		// Short-circuit preflight requests
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			if allowed != "" {
+				methods := cors.AllowedMethods
+				if len(methods) == 0 {
+					methods = defaultCORSMethods
+				}
+				w.Header().Set("Access-Control-Allow-Methods", strings.Join(methods, ", "))
+
+				// Without configured headers, allow whatever the browser asked for
+				if len(cors.AllowedHeaders) > 0 {
+					w.Header().Set("Access-Control-Allow-Headers", strings.Join(cors.AllowedHeaders, ", "))
+				} else if requested := r.Header.Get("Access-Control-Request-Headers"); requested != "" {
+					w.Header().Set("Access-Control-Allow-Headers", requested)
+				}
+			}
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// allowedOrigin returns the value for Access-Control-Allow-Origin, or "" if the origin is not allowed
+func allowedOrigin(allowedOrigins []string, origin string) string {
+	if slices.Contains(allowedOrigins, "*") {
+		return "*"
+	}
+	if slices.Contains(allowedOrigins, origin) {
+		return origin
+	}
+	return ""
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// generateCurls writes markdown documentation with a curl example for every route
+// Each server of a multi-server config gets its own section
+func generateCurls(config *Config, configFile, outputFile string) error {
+	f, err := os.Create(outputFile)
+	if err != nil {
+		return fmt.Errorf("failed to create output file: %w", err)
+	}
+	defer f.Close()
+
+	// Write markdown header
+	fmt.Fprintln(f, "# API Endpoints")
+	fmt.Fprintln(f, "")
+	fmt.Fprintf(f, "> Auto-generated from `%s`\n", configFile)
+	fmt.Fprintln(f, "")
+
+	groups := config.serverGroups()
+	count := 0
+	for _, group := range groups {
+		count += writeServerDoc(f, group, len(groups) > 1)
+	}
+
+	fmt.Printf("Generated documentation for %d endpoints in %s\n", count, outputFile)
+	return nil
+}
+
+// writeServerDoc documents one server's built-in endpoints and routes, returning
+// how many endpoints were written
+func writeServerDoc(f io.Writer, config *Config, titled bool) int {
+	baseURL := serverURL(config)
+	if titled {
+		fmt.Fprintf(f, "# Server on port %d\n", config.Server.Port)
+		fmt.Fprintln(f, "")
+	}
+	fmt.Fprintf(f, "**Base URL:** `%s`\n", baseURL)
+	fmt.Fprintln(f, "")
+	fmt.Fprintln(f, "---")
+	fmt.Fprintln(f, "")
+
+	// Add health check
+	fmt.Fprintln(f, "## Health Check")
+	fmt.Fprintln(f, "")
+	fmt.Fprintln(f, "**GET** `/_health`")
+	fmt.Fprintln(f, "")
+	fmt.Fprintln(f, "```bash")
+	fmt.Fprintf(f, "curl %s/_health\n", baseURL)
+	fmt.Fprintln(f, "```")
+	fmt.Fprintln(f, "")
+	fmt.Fprintln(f, "---")
+	fmt.Fprintln(f, "")
+
+	// Add route listing
+	fmt.Fprintln(f, "## Route Listing")
+	fmt.Fprintln(f, "")
+	fmt.Fprintln(f, "**GET** `/_routes`")
+	fmt.Fprintln(f, "")
+	fmt.Fprintln(f, "```bash")
+	fmt.Fprintf(f, "curl %s/_routes\n", baseURL)
+	fmt.Fprintln(f, "```")
+	fmt.Fprintln(f, "")
+	fmt.Fprintln(f, "---")
+	fmt.Fprintln(f, "")
+
+	// Generate documentation for each route, relative to the base path
+	routes := expandMethods(config.Routes)
+	routeURL := baseURL + config.Server.BasePath
+	for _, route := range routes {
+		writeRouteDoc(f, route, routeURL, config.Server.DefaultHeaders)
+	}
+	return len(routes) + 2
+}
+
+func writeRouteDoc(f io.Writer, route Route, baseURL string, defaultHeaders map[string]string) {
+	// Convert path parameters to examples
+	examplePath := convertPathToExample(route.Path)
+
+	// Header with method and path
+	fmt.Fprintf(f, "## %s %s\n", route.Method, route.Path)
+	fmt.Fprintln(f, "")
+
+	// Auth requirements
+	if route.RequiresAuth && route.AuthType == authTypeBasic {
+		fmt.Fprintln(f, "🔒 **Requires Authentication:** HTTP Basic")
+		fmt.Fprintln(f, "")
+	} else if route.RequiresAuth {
+		fmt.Fprintf(f, "🔒 **Requires Authentication:** `%s` header\n", route.AuthHeader)
+		fmt.Fprintln(f, "")
+	}
+
+	// Response info, from the first response the route sends
+	resp := route.firstResponse()
+	fmt.Fprintf(f, "**Response:** `%d` (`%s`)\n", route.firstStatus(), resp.contentType(defaultHeaders))
+	fmt.Fprintln(f, "")
+
+	// Build curl command
+	var curlParts []string
+	curlParts = append(curlParts, "curl")
+
+	// Routes matching any method are documented with a plain GET
+	if route.Method != "GET" && route.Method != "HEAD" && route.Method != "*" && route.Method != "ANY" {
+		curlParts = append(curlParts, fmt.Sprintf("-X %s", route.Method))
+	}
+
+	if route.RequiresAuth && route.AuthType == authTypeBasic {
+		curlParts = append(curlParts, fmt.Sprintf("-u \"%s:%s\"", route.Username, route.Password))
+	} else if route.RequiresAuth {
+		authValue := "YOUR_TOKEN_HERE"
+		if route.AuthHeader == "Authorization" {
+			authValue = "Bearer " + authValue
+		}
+		curlParts = append(curlParts, fmt.Sprintf("-H \"%s: %s\"", route.AuthHeader, authValue))
+	}
+
+	if route.Method == "HEAD" {
+		curlParts = append(curlParts, "-I")
+	}
+
+	curlParts = append(curlParts, fmt.Sprintf("%s%s", baseURL, examplePath))
+
+	// Curl example
+	fmt.Fprintln(f, "```bash")
+	fmt.Fprintln(f, strings.Join(curlParts, " "))
+	fmt.Fprintln(f, "```")
+	fmt.Fprintln(f, "")
+
+	// Example response body (if not empty/null)
+	if resp.Body != nil && route.firstStatus() != 204 {
+		fmt.Fprintln(f, "<details>")
+		fmt.Fprintln(f, "<summary>Example Response</summary>")
+		fmt.Fprintln(f, "")
+		fmt.Fprintln(f, "```json")
+		bodyJSON, _ := json.MarshalIndent(resp.Body, "", "  ")
+		fmt.Fprintln(f, string(bodyJSON))
+		fmt.Fprintln(f, "```")
+		fmt.Fprintln(f, "</details>")
+		fmt.Fprintln(f, "")
+	}
+
+	fmt.Fprintln(f, "---")
+	fmt.Fprintln(f, "")
+}
+
+// typedParamPattern matches {name:type} path parameters
+var typedParamPattern = regexp.MustCompile(`\{([^}:]+):[^}]*\}`)
+
+// paramExamples are example values for commonly named path parameters
+var paramExamples = map[string]string{
+	"id":        "123",
+	"userId":    "456",
+	"productId": "789",
+	"orderId":   "order-123",
+	"itemId":    "item-456",
+}
+
+// typeExamples are example values for typed path parameters without a fitting named example
+var typeExamples = map[string]string{
+	"int":   "123",
+	"uuid":  "123e4567-e89b-12d3-a456-426614174000",
+	"alpha": "example",
+	"alnum": "example",
+}
+
+// convertPathToExample replaces each {param} segment with an example value
+func convertPathToExample(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if name, typ, ok := parseParam(segment); ok {
+			segments[i] = exampleValue(name, typ)
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// exampleValue returns an example for a path parameter: the one for its name if
+// that fits its type, else one of its type, else a generic value
+func exampleValue(name, typ string) string {
+	if example, ok := paramExamples[name]; ok && paramMatches(typ, example) {
+		return example
+	}
+	if example, ok := typeExamples[typ]; ok {
+		return example
+	}
+	return "example-value"
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// defaultDripChunkSize is used when dripMs is set without dripChunkSize
+const defaultDripChunkSize = 64
+
+// dripWriter writes data in small chunks, flushing and pausing between each one
+// to simulate a slow connection
+type dripWriter struct {
+	w         http.ResponseWriter
+	ctx       context.Context
+	rc        *http.ResponseController
+	chunkSize int
+	interval  time.Duration
+	started   bool
+}
+
+// newDripWriter wraps w for a response configured with dripMs
+// It returns nil if w can't be flushed, in which case the body should be written normally
+func newDripWriter(w http.ResponseWriter, r *http.Request, resp *Response) *dripWriter {
+	rc := http.NewResponseController(w)
+	if err := rc.Flush(); err != nil {
+		return nil
+	}
+
+	chunkSize := resp.DripChunkSize
+	if chunkSize <= 0 {
+		chunkSize = defaultDripChunkSize
+	}
+
+	return &dripWriter{
+		w:         w,
+		ctx:       r.Context(),
+		rc:        rc,
+		chunkSize: chunkSize,
+		interval:  time.Duration(resp.DripMs) * time.Millisecond,
+	}
+}
+
+// Write sends p in chunks, stopping early if the client goes away
+func (d *dripWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		if d.started && !sleepContext(d.ctx, d.interval) {
+			return written, d.ctx.Err()
+		}
+		d.started = true
+
+		n := min(d.chunkSize, len(p))
+		if _, err := d.w.Write(p[:n]); err != nil {
+			return written, err
+		}
+		if err := d.rc.Flush(); err != nil {
+			return written, err
+		}
+		written += n
+		p = p[n:]
+	}
+	return written, nil
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httputil"
+	"strings"
+)
+
+// Supported values for ServerConfig.DumpRequests and the -dump flag
+const (
+	dumpAll       = "all"
+	dumpUnmatched = "unmatched"
+)
+
+// shouldDump reports whether a request is dumped under the mode, given whether
+// it matched a route
+func shouldDump(mode string, matched bool) bool {
+	return mode == dumpAll || (mode == dumpUnmatched && !matched)
+}
+
+// dumpRequest logs the full request as it came in: request line, headers and the
+// buffered body, which is restored afterwards for anything that reads it later
+func dumpRequest(lg *logger, r *http.Request, body []byte) {
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	dump, err := httputil.DumpRequest(r, true)
+	if err != nil {
+		lg.Errorf("  ✗ Failed to dump request: %v", err)
+		return
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	// Indent the dump under the request's other log lines
+	lines := strings.Split(strings.TrimRight(strings.ReplaceAll(string(dump), "\r\n", "\n"), "\n"), "\n")
+	for i, line := range lines {
+		if line != "" {
+			lines[i] = "    " + line
+		}
+	}
+	lg.Printf("  … Request dump:\n%s", strings.Join(lines, "\n"))
+}
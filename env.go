@@ -0,0 +1,34 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+)
+
+// envPattern matches ${VAR} references in the config file
+var envPattern = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// strictEnv makes unset variables a config error instead of expanding to ""
+var strictEnv bool
+
+// expandEnv replaces ${VAR} references in raw config data with environment values
+// Values are JSON-escaped so they are safe to use inside string fields
+func expandEnv(data []byte) ([]byte, error) {
+	var missing []string
+	expanded := envPattern.ReplaceAllFunc(data, func(ref []byte) []byte {
+		name := string(envPattern.FindSubmatch(ref)[1])
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			missing = append(missing, name)
+		}
+		escaped, _ := json.Marshal(value)
+		return escaped[1 : len(escaped)-1]
+	})
+
+	if strictEnv && len(missing) > 0 {
+		return nil, fmt.Errorf("unset environment variables: %v", missing)
+	}
+	return expanded, nil
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+)
+
+// etagWriter buffers a response body so an ETag can be computed from it,
+// answering conditional GET and HEAD requests with a 304 when it matches
+type etagWriter struct {
+	http.ResponseWriter
+	r      *http.Request
+	status int
+	body   bytes.Buffer
+}
+
+// newETagWriter wraps w for a response with ETags enabled
+func newETagWriter(w http.ResponseWriter, r *http.Request) *etagWriter {
+	return &etagWriter{ResponseWriter: w, r: r, status: http.StatusOK}
+}
+
+// WriteHeader holds the status back until the body is complete
+func (e *etagWriter) WriteHeader(status int) {
+	e.status = status
+}
+
+// Write buffers the body
+func (e *etagWriter) Write(p []byte) (int, error) {
+	return e.body.Write(p)
+}
+
+// Unwrap returns the underlying writer, for http.ResponseController
+func (e *etagWriter) Unwrap() http.ResponseWriter {
+	return e.ResponseWriter
+}
+
+// finish sets the ETag header for successful responses and sends either a 304
+// or the buffered response, returning the status sent
+// An ETag already set in the response headers is used instead of computing one
+func (e *etagWriter) finish() (int, error) {
+	header := e.Header()
+	if e.status >= 200 && e.status < 300 {
+		if header.Get("ETag") == "" {
+			sum := sha256.Sum256(e.body.Bytes())
+			header.Set("ETag", `"`+hex.EncodeToString(sum[:8])+`"`)
+		}
+
+		safe := e.r.Method == http.MethodGet || e.r.Method == http.MethodHead
+		if safe && e.status == http.StatusOK && etagMatches(e.r.Header.Get("If-None-Match"), header.Get("ETag")) {
+			header.Del("Content-Length")
+			e.ResponseWriter.WriteHeader(http.StatusNotModified)
+			return http.StatusNotModified, nil
+		}
+	}
+
+	e.ResponseWriter.WriteHeader(e.status)
+	_, err := e.ResponseWriter.Write(e.body.Bytes())
+	return e.status, err
+}
+
+// etagMatches reports whether an If-None-Match header matches the ETag, using
+// weak comparison so W/ prefixes are ignored
+func etagMatches(ifNoneMatch, etag string) bool {
+	if ifNoneMatch == "" || etag == "" {
+		return false
+	}
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,49 @@
+package main
+
+import "fmt"
+
+// generators are the documents -generate can write, by name, with the file each
+// is written to by default
+var generators = map[string]struct {
+	output string
+	write  func(config *Config, configFile, outputFile string) error
+}{
+	"curls":   {"ENDPOINTS.md", generateCurls},
+	"openapi": {"openapi.json", generateOpenAPI},
+	"postman": {"postman_collection.json", generatePostman},
+}
+
+// runGenerator writes the named document for a loaded config, to outputFile or
+// the generator's default file if it is empty
+func runGenerator(name string, config *Config, configFile, outputFile string) error {
+	generator, ok := generators[name]
+	if !ok {
+		return fmt.Errorf("unknown generator %q: must be curls, openapi or postman", name)
+	}
+	if outputFile == "" {
+		outputFile = generator.output
+	}
+	return generator.write(config, configFile, outputFile)
+}
+
+// serverURL returns the address a server is reached at, before its base path
+func serverURL(config *Config) string {
+	scheme := "http"
+	if config.Server.TLS != nil {
+		scheme = "https"
+	}
+	return fmt.Sprintf("%s://%s", scheme, displayAddr(config.Server.Host, config.Server.Port))
+}
+
+// expandMethods turns routes with a methods list into one route per method
+func expandMethods(routes []Route) []Route {
+	var expanded []Route
+	for _, route := range routes {
+		for _, method := range route.methods() {
+			route.Method = method
+			route.Methods = nil
+			expanded = append(expanded, route)
+		}
+	}
+	return expanded
+}
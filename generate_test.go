@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGenerateCoversEveryServer(t *testing.T) {
+	config := loadTestConfig(t, `{"servers": [
+		{"server": {"port": 8081}, "routes": [{"method": "GET", "path": "/users", "response": {"status": 200, "body": []}}]},
+		{"server": {"port": 8082, "basePath": "/v2"}, "routes": [{"method": "GET", "path": "/orders/{id:int}", "response": {"status": 200}}]}
+	]}`)
+
+	tests := map[string][]string{
+		"curls":   {"curl http://localhost:8081/users", "curl http://localhost:8082/v2/orders/123"},
+		"openapi": {`"url": "http://localhost:8081"`, `"url": "http://localhost:8082/v2"`, `"/users"`, `"/orders/{id}"`},
+		"postman": {`"key": "baseUrl8081"`, `"value": "http://localhost:8082/v2"`, `"raw": "{{baseUrl8082}}/orders/:id"`},
+	}
+	for name, wants := range tests {
+		output := filepath.Join(t.TempDir(), name)
+		if err := runGenerator(name, config, "config.json", output); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		got := readTestFile(t, output)
+		for _, want := range wants {
+			if !strings.Contains(got, want) {
+				t.Errorf("%s: output missing %s:\n%s", name, want, got)
+			}
+		}
+	}
+}
+
+func TestGenerateFromConfigDirectory(t *testing.T) {
+	t.Setenv("MOCK_PORT", "9090")
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "server.json"), `{"server": {"port": ${MOCK_PORT}}}`)
+	writeTestFile(t, filepath.Join(dir, "users.json"), `{"method": "GET", "path": "/users", "response": {"status": 200}}`)
+
+	config, err := LoadConfig(dir)
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	output := filepath.Join(t.TempDir(), "ENDPOINTS.md")
+	if err := runGenerator("curls", config, dir, output); err != nil {
+		t.Fatal(err)
+	}
+	if got := readTestFile(t, output); !strings.Contains(got, "curl http://localhost:9090/users") {
+		t.Errorf("output missing the route from users.json on port 9090:\n%s", got)
+	}
+}
+
+func TestGenerateDocumentsFirstResponse(t *testing.T) {
+	config := loadTestConfig(t, `{"server": {"port": 8080}, "routes": [
+		{"method": "POST", "path": "/jobs", "responses": [
+			{"status": 202, "headers": {"content-type": "application/vnd.job+json"}, "body": {"state": "queued"}},
+			{"status": 200, "body": {"state": "done"}}
+		]},
+		{"method": "GET", "path": "/flaky", "weightedResponses": [{"weight": 1, "response": {"status": 503, "body": {"error": "down"}}}]},
+		{"method": "GET", "path": "/counted", "responseByHitCount": [{"from": 1, "to": 1, "response": {"status": 201, "body": {"first": true}}}]}
+	]}`)
+
+	tests := map[string][]string{
+		"curls":   {"**Response:** `202` (`application/vnd.job+json`)", `"state": "queued"`, "**Response:** `503`", "**Response:** `201`"},
+		"openapi": {`"202"`, `"application/vnd.job+json"`, `"queued"`, `"503"`, `"201"`},
+		"postman": {`"code": 202`, `"value": "application/vnd.job+json"`, `"code": 503`, `"code": 201`},
+	}
+	for name, wants := range tests {
+		output := filepath.Join(t.TempDir(), name)
+		if err := runGenerator(name, config, "config.json", output); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		got := readTestFile(t, output)
+		for _, want := range wants {
+			if !strings.Contains(got, want) {
+				t.Errorf("%s: output missing %s:\n%s", name, want, got)
+			}
+		}
+	}
+}
+
+func TestGeneratorsShareExampleValues(t *testing.T) {
+	config := loadTestConfig(t, `{"server": {"port": 8080}, "routes": [
+		{"method": "GET", "path": "/users/{userId}/orders/{orderId:int}/items/{ref:uuid}/{slug}", "response": {"status": 200}}
+	]}`)
+
+	example := "/users/456/orders/123/items/123e4567-e89b-12d3-a456-426614174000/example-value"
+	if got := convertPathToExample(config.Routes[0].Path); got != example {
+		t.Errorf("convertPathToExample: %s, want %s", got, example)
+	}
+
+	output := filepath.Join(t.TempDir(), "ENDPOINTS.md")
+	if err := runGenerator("curls", config, "config.json", output); err != nil {
+		t.Fatal(err)
+	}
+	if got := readTestFile(t, output); !strings.Contains(got, "curl http://localhost:8080"+example) {
+		t.Errorf("curls: output missing the example path %s:\n%s", example, got)
+	}
+
+	output = filepath.Join(t.TempDir(), "postman_collection.json")
+	if err := runGenerator("postman", config, "config.json", output); err != nil {
+		t.Fatal(err)
+	}
+	var collection postmanCollection
+	if err := json.Unmarshal([]byte(readTestFile(t, output)), &collection); err != nil {
+		t.Fatal(err)
+	}
+	var values []string
+	for _, variable := range collection.Item[0].Request.URL.Variable {
+		values = append(values, variable.Value)
+	}
+	if got, want := strings.Join(values, "/"), "456/123/123e4567-e89b-12d3-a456-426614174000/example-value"; got != want {
+		t.Errorf("postman: variables %s, want %s", got, want)
+	}
+}
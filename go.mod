@@ -1,3 +1,11 @@
 module mockery-api
 
-go 1.25.0
+go 1.26.0
+
+require (
+	github.com/andybalholm/brotli v1.2.5
+	github.com/santhosh-tekuri/jsonschema/v6 v6.0.3
+	golang.org/x/net v0.59.0
+	golang.org/x/text v0.42.0
+	golang.org/x/time v0.16.0
+)
@@ -1,107 +1,1107 @@
 package main
 
 import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
+	"maps"
+	"math"
+	"math/rand"
+	"mime"
 	"net/http"
+	"net/url"
+	"os"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
+)
+
+// regexPrefix marks a route path as a regular expression
+const regexPrefix = "~"
+
+// defaultStatusOverrideHeader is used when no statusOverrideHeader is configured
+const defaultStatusOverrideHeader = "X-Mock-Status"
+
+// regexCache holds compiled regex path patterns keyed by pattern
+var (
+	regexCacheMu sync.RWMutex
+	regexCache   = make(map[string]*regexp.Regexp)
 )
 
 // MockHandler handles incoming HTTP requests and matches them against configured routes
 type MockHandler struct {
-	routes []Route
+	mu              sync.RWMutex
+	server          ServerConfig
+	routes          []Route
+	defaultResponse *Response
+	limiters        *rateLimiters
+	requestLog      *requestLogger
+	store           *memoryStore
+	metrics         *metrics
+	readyAt         time.Time
+	slots           chan struct{}
+
+	// stateMu guards mutable per-route state, which is reset on reload
+	stateMu    sync.Mutex
+	sequences  map[*Route]int
+	hits       map[*Route]int
+	counts     map[*Route]int
+	idempotent map[idempotencyKey]*cachedResponse
 }
 
-// NewMockHandler creates a new handler with the given routes
-func NewMockHandler(routes []Route) *MockHandler {
+// NewMockHandler creates a new handler serving the routes from the given config
+// Server settings are fixed for the lifetime of the handler
+func NewMockHandler(config *Config) *MockHandler {
+	var slots chan struct{}
+	if config.Server.MaxConcurrent > 0 {
+		slots = make(chan struct{}, config.Server.MaxConcurrent)
+	}
 	return &MockHandler{
-		routes: routes,
+		server:          config.Server,
+		routes:          config.Routes,
+		readyAt:         time.Now().Add(time.Duration(config.Server.StartupDelayMs) * time.Millisecond),
+		slots:           slots,
+		defaultResponse: config.DefaultResponse,
+		limiters:        newRateLimiters(),
+		store:           newMemoryStore(),
+		metrics:         newMetrics(),
+		sequences:       make(map[*Route]int),
+		hits:            make(map[*Route]int),
+		counts:          make(map[*Route]int),
+		idempotent:      make(map[idempotencyKey]*cachedResponse),
 	}
 }
 
+// Reload atomically replaces the routes and fallback response served by the handler
+func (h *MockHandler) Reload(config *Config) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.routes = config.Routes
+	h.defaultResponse = config.DefaultResponse
+	h.limiters.reset()
+	h.metrics.resetRoutes()
+
+	h.stateMu.Lock()
+	h.sequences = make(map[*Route]int)
+	h.hits = make(map[*Route]int)
+	h.counts = make(map[*Route]int)
+	h.idempotent = make(map[idempotencyKey]*cachedResponse)
+	h.stateMu.Unlock()
+}
+
+// Reset clears stateful route data, rewinds sequenced responses to the start,
+// restores the hits of maxHits routes, restarts hit counts and forgets idempotent
+// responses, returning the number of stored items removed
+func (h *MockHandler) Reset() int {
+	h.stateMu.Lock()
+	h.sequences = make(map[*Route]int)
+	h.hits = make(map[*Route]int)
+	h.counts = make(map[*Route]int)
+	h.idempotent = make(map[idempotencyKey]*cachedResponse)
+	h.stateMu.Unlock()
+
+	return h.store.Reset()
+}
+
 // ServeHTTP implements the http.Handler interface
 func (h *MockHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	ip := clientIP(r, h.server.TrustProxyHeaders)
+
+	// Tag the request with an id if enabled, echoing it in the response and the logs
+	var id string
+	if h.server.RequestID {
+		id = requestID(r)
+		w.Header().Set(requestIDHeader, id)
+	}
+
+	lg := newLogger(h.server.LogFormat, h.server.LogLevel, r, ip, id)
+	r = withLogger(r, lg)
+
 	// Log incoming request
-	log.Printf("[%s] %s", r.Method, r.URL.Path)
+	lg.Printf("[%s] %s", r.Method, r.URL.Path)
+
+	// Compress the response if enabled and the client supports it
+	if h.server.Compression {
+		if encoding := negotiateEncoding(r); encoding != "" {
+			cw := newCompressResponseWriter(w, r, encoding)
+			defer cw.Close()
+			w = cw
+		}
+	}
+
+	rec := newResponseRecorder(w)
+
+	// Capture the body for the request log and dumps before anything else reads it,
+	// reading it up front when a size limit is set so oversized bodies are rejected
+	// before matching
+	var body []byte
+	var bodyErr error
+	if limit := h.server.MaxBodyBytes; limit > 0 {
+		r.Body = http.MaxBytesReader(rec, r.Body, limit)
+		body, bodyErr = bufferBody(r)
+	} else if h.requestLog != nil || h.server.DumpRequests != "" {
+		body, _ = bufferBody(r)
+	}
+
+	var route *Route
+	var tooLarge *http.MaxBytesError
+	if errors.As(bodyErr, &tooLarge) {
+		lg.Errorf("  ✗ Request body exceeds %d bytes", tooLarge.Limit)
+		writeJSONError(rec, http.StatusRequestEntityTooLarge, "request body too large")
+	} else {
+		route = h.serve(rec, r)
+	}
+	if shouldDump(h.server.DumpRequests, route != nil) {
+		dumpRequest(lg, r, body)
+	}
+	lg.Finish(route, rec.status, rec.written)
+	h.metrics.Record(r, route, rec.status, time.Since(start))
+
+	if h.requestLog != nil {
+		if err := h.requestLog.Record(r, ip, body, route, rec.status); err != nil {
+			log.Printf("Error writing request log: %v", err)
+		}
+	}
+}
+
+// serve handles a request and returns the route that matched, if any
+func (h *MockHandler) serve(w http.ResponseWriter, r *http.Request) *Route {
+	lg := loggerFrom(r)
+
+	// Hold one of the server's slots while the request is handled
+	if h.slots != nil {
+		if !h.acquireSlot(w, r) {
+			return nil
+		}
+		defer func() { <-h.slots }()
+	}
+
+	// Apply the global rate limit before doing any matching
+	if limit := h.server.RateLimit; limit != nil && !h.checkRateLimit(w, r, nil, limit) {
+		return nil
+	}
 
 	// Find matching route
-	route := h.findRoute(r.Method, r.URL.Path)
+	route, params := h.findRoute(r)
+	lg.Matched(route)
 	if route == nil {
-		log.Printf("  ✗ No route matched")
+		// A path served for other methods gets a 405 rather than a 404
+		if allowed := h.allowedMethods(r); len(allowed) > 0 {
+			lg.Errorf("  ✗ Method not allowed, path supports %s", strings.Join(allowed, ", "))
+			w.Header().Set("Allow", strings.Join(allowed, ", "))
+			writeErrorBody(w, http.StatusMethodNotAllowed, h.server.MethodNotAllowedBody, "method not allowed")
+			return nil
+		}
+
+		lg.Errorf("  ✗ No route matched")
+		if fallback := h.fallbackResponse(); fallback != nil {
+			h.writeResponse(w, r, fallback, nil)
+			return nil
+		}
+		if h.server.NotFoundBody != nil {
+			writeErrorBody(w, http.StatusNotFound, h.server.NotFoundBody, "")
+			return nil
+		}
 		http.NotFound(w, r)
-		return
+		return nil
+	}
+
+	lg.Printf("  ✓ Matched route: %s", route)
+	if len(params) > 0 {
+		lg.Debugf("  … Path params: %v", params)
 	}
+	lg.Debugf("  … Request headers: %v", r.Header)
 
-	log.Printf("  ✓ Matched route: %s %s", route.Method, route.Path)
+	// Apply the per-route rate limit
+	if route.RateLimit != nil && !h.checkRateLimit(w, r, route, route.RateLimit) {
+		return route
+	}
 
 	// Check auth if required
-	if route.RequiresAuth {
-		authValue := r.Header.Get(route.AuthHeader)
-		if authValue == "" {
-			log.Printf("  ✗ Auth failed: missing header '%s'", route.AuthHeader)
-			http.Error(w, "Unauthorized: missing auth header", http.StatusUnauthorized)
+	if route.RequiresAuth && !checkAuth(w, r, route) {
+		return route
+	}
+
+	// Reject bodies that don't match the route's schema
+	if route.requestSchema != nil && !checkRequestSchema(w, r, route.requestSchema) {
+		return route
+	}
+
+	// Replay the response already sent for a repeated Idempotency-Key, otherwise
+	// keep a copy of this response to replay later
+	if key := r.Header.Get(idempotencyKeyHeader); route.Idempotent && key != "" {
+		if cached := h.cachedIdempotent(route, key); cached != nil {
+			lg.Printf("  ✓ Replaying response for Idempotency-Key %q", key)
+			cached.replay(w)
+			return route
+		}
+		cw := newIdempotencyWriter(w)
+		defer h.storeIdempotent(route, key, cw)
+		w = cw
+	}
+
+	// Remember request values for {{state.<key>}} placeholders in later responses
+	h.captureState(r, route, params)
+
+	// Forward to the real upstream instead of mocking
+	if route.ProxyTo != "" {
+		proxyRequest(w, r, route.ProxyTo)
+		return route
+	}
+
+	// Serve from the in-memory store for stateful routes
+	if route.Stateful && h.serveStateful(w, r, route, params) {
+		return route
+	}
+
+	resp := h.selectResponse(r, route)
+
+	// Let the client pick the status code if the route allows it
+	if route.AllowStatusOverride {
+		if value := r.Header.Get(h.statusOverrideHeader()); value != "" {
+			status, err := strconv.Atoi(value)
+			if err != nil || status < 100 || status > 599 {
+				lg.Errorf("  ✗ Invalid status override: %q", value)
+				writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("invalid status override %q", value))
+				return route
+			}
+			lg.Printf("  ✓ Status overridden to %d", status)
+			overridden := *resp
+			overridden.Status = status
+			resp = &overridden
+		}
+	}
+
+	h.writeResponse(w, r, resp, params)
+	return route
+}
+
+// statusOverrideHeader returns the request header used to override response status codes
+func (h *MockHandler) statusOverrideHeader() string {
+	if h.server.StatusOverrideHeader != "" {
+		return h.server.StatusOverrideHeader
+	}
+	return defaultStatusOverrideHeader
+}
+
+// serveStateful handles POST, GET and DELETE against the in-memory store
+// It returns false for other methods so the route's static response is used instead
+func (h *MockHandler) serveStateful(w http.ResponseWriter, r *http.Request, route *Route, params map[string]string) bool {
+	lg := loggerFrom(r)
+
+	collection := storeCollection(route.Path)
+	id, hasID := params["id"]
+
+	// Reuse the route's status, headers and delays with the stored data as the body
+	resp := route.Response
+	resp.BodyFile = ""
+
+	switch r.Method {
+	case http.MethodPost:
+		data, err := bufferBody(r)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, "failed to read request body")
+			return true
+		}
+		var item interface{}
+		if err := json.Unmarshal(data, &item); err != nil {
+			lg.Errorf("  ✗ Invalid JSON body for stateful route: %v", err)
+			writeJSONError(w, http.StatusBadRequest, "request body must be valid JSON")
+			return true
+		}
+		resp.Body = h.store.Add(collection, item)
+		lg.Printf("  ✓ Stored item in %s", collection)
+
+	case http.MethodGet:
+		if hasID {
+			item, ok := h.store.Get(collection, id)
+			if !ok {
+				writeJSONError(w, http.StatusNotFound, "item not found")
+				return true
+			}
+			resp.Body = item
+		} else {
+			resp.Body = h.store.List(collection)
+		}
+
+	case http.MethodDelete:
+		if !hasID || !h.store.Delete(collection, id) {
+			writeJSONError(w, http.StatusNotFound, "item not found")
+			return true
+		}
+		lg.Printf("  ✓ Deleted item %s from %s", id, collection)
+		resp.Body = nil
+
+	default:
+		return false
+	}
+
+	h.writeResponse(w, r, &resp, nil)
+	return true
+}
+
+// selectResponse picks the response for a matched route
+// The first condition whose header matches wins; otherwise routes with weighted responses
+// pick one at random, and routes with a responses list return each entry in turn,
+// wrapping around after the last
+func (h *MockHandler) selectResponse(r *http.Request, route *Route) *Response {
+	for i := range route.When {
+		cond := &route.When[i]
+		if r.Header.Get(cond.Header) == cond.Value {
+			loggerFrom(r).Printf("  ✓ Condition matched: %s: %s", cond.Header, cond.Value)
+			return &cond.Response
+		}
+	}
+
+	if len(route.ResponseByHitCount) > 0 {
+		return h.hitCountResponse(r, route)
+	}
+
+	if len(route.WeightedResponses) > 0 {
+		return pickWeighted(r, route.WeightedResponses)
+	}
+
+	if len(route.Responses) == 0 {
+		return &route.Response
+	}
+
+	h.stateMu.Lock()
+	defer h.stateMu.Unlock()
+
+	i := h.sequences[route]
+	h.sequences[route] = (i + 1) % len(route.Responses)
+	loggerFrom(r).Printf("  ✓ Sequenced response %d of %d", i+1, len(route.Responses))
+	return &route.Responses[i]
+}
+
+// hitCountResponse counts the request against the route and returns the response
+// for the range it falls in, or the route's response if no range covers it
+func (h *MockHandler) hitCountResponse(r *http.Request, route *Route) *Response {
+	h.stateMu.Lock()
+	h.counts[route]++
+	n := h.counts[route]
+	h.stateMu.Unlock()
+
+	for i := range route.ResponseByHitCount {
+		if hr := &route.ResponseByHitCount[i]; hr.covers(n) {
+			loggerFrom(r).Printf("  ✓ Request %d, hit count range %d", n, i+1)
+			return &hr.Response
+		}
+	}
+	loggerFrom(r).Printf("  ✓ Request %d, outside every hit count range", n)
+	return &route.Response
+}
+
+// pickWeighted chooses a response at random, with probability proportional to its weight
+func pickWeighted(r *http.Request, choices []WeightedResponse) *Response {
+	total := 0
+	for _, choice := range choices {
+		total += choice.Weight
+	}
+
+	n := rand.Intn(total)
+	for i := range choices {
+		if n < choices[i].Weight {
+			loggerFrom(r).Printf("  ✓ Weighted response %d of %d", i+1, len(choices))
+			return &choices[i].Response
+		}
+		n -= choices[i].Weight
+	}
+	return &choices[len(choices)-1].Response
+}
+
+// acquireSlot takes a slot for the request when the server has capacity, either
+// queueing until one frees up or writing a 503 when it's full
+// It returns false when the request was rejected or gave up waiting
+func (h *MockHandler) acquireSlot(w http.ResponseWriter, r *http.Request) bool {
+	lg := loggerFrom(r)
+
+	select {
+	case h.slots <- struct{}{}:
+		return true
+	default:
+	}
+
+	if !h.server.QueueWhenBusy {
+		lg.Errorf("  ✗ Server busy: %d requests already in progress", cap(h.slots))
+		writeJSONError(w, http.StatusServiceUnavailable, "server busy")
+		return false
+	}
+
+	lg.Printf("  … Server busy, queueing request")
+	select {
+	case h.slots <- struct{}{}:
+		return true
+	case <-r.Context().Done():
+		lg.Errorf("  ✗ Client disconnected while queued")
+		return false
+	}
+}
+
+// checkRateLimit takes a token for the route, or the global limit if route is nil,
+// writing a 429 if none are left. It returns false when the request was rejected
+func (h *MockHandler) checkRateLimit(w http.ResponseWriter, r *http.Request, route *Route, limit *RateLimitConfig) bool {
+	allowed, wait := h.limiters.allow(rateLimitKey(route, limit, clientIP(r, h.server.TrustProxyHeaders)), limit)
+	if allowed {
+		return true
+	}
+
+	scope := "global"
+	if route != nil {
+		scope = route.String()
+	}
+	loggerFrom(r).Errorf("  ✗ Rate limit exceeded (%s)", scope)
+	w.Header().Set("Retry-After", strconv.Itoa(retryAfterSeconds(wait)))
+	writeJSONError(w, http.StatusTooManyRequests, "rate limit exceeded")
+	return false
+}
+
+// dropConnection hijacks the underlying connection and closes it without writing
+// anything, returning false if the connection can't be hijacked (e.g. HTTP/2)
+func dropConnection(w http.ResponseWriter) bool {
+	conn, _, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
+
+// fallbackResponse returns the configured response for unmatched requests, if any
+func (h *MockHandler) fallbackResponse() *Response {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.defaultResponse
+}
+
+// writeResponse sends a configured response, applying any delay, headers and body
+// Path parameters are substituted into the body when present
+func (h *MockHandler) writeResponse(w http.ResponseWriter, r *http.Request, resp *Response, params map[string]string) {
+	lg := loggerFrom(r)
+	params = h.withState(params)
+	if resp.usesRequestFields() {
+		params = withRequestBody(params, r)
+	}
+
+	// Simulate latency if configured, giving up if the client goes away
+	if delay := responseDelay(resp); delay > 0 {
+		lg.Printf("  … Delaying response by %v", delay)
+		if !sleepContext(r.Context(), delay) {
+			lg.Errorf("  ✗ Client disconnected during delay")
 			return
 		}
-		log.Printf("  ✓ Auth header '%s' present", route.AuthHeader)
 	}
 
-	// Set custom response headers if configured
-	if route.Response.Headers != nil {
-		for key, value := range route.Response.Headers {
-			w.Header().Set(key, value)
+	// Simulate a network failure by closing the connection without a response
+	if resp.DropConnection {
+		if dropConnection(w) {
+			lg.Errorf("  ✗ Dropped connection")
+			return
 		}
+		lg.Errorf("  ✗ Connection can't be dropped (not hijackable), sending response normally")
 	}
 
-	// Always set Content-Type to application/json
-	w.Header().Set("Content-Type", "application/json")
+	// Randomly fail instead of sending the configured response
+	if resp.FailureRate > 0 && rand.Float64() < resp.FailureRate {
+		status := resp.FailureStatus
+		if status == 0 {
+			status = http.StatusServiceUnavailable
+		}
+		lg.Errorf("  ✗ Injected failure: %d", status)
+		writeJSONError(w, status, "injected failure")
+		return
+	}
+
+	// Open the body file up front so a missing file can still be reported as a 500
+	var bodyFile *os.File
+	if resp.BodyFile != "" {
+		f, err := os.Open(resp.BodyFile)
+		if err != nil {
+			lg.Errorf("  ✗ Error opening body file: %v", err)
+			writeJSONError(w, http.StatusInternalServerError, fmt.Sprintf("failed to read body file %s", resp.BodyFile))
+			return
+		}
+		defer f.Close()
+		bodyFile = f
+	}
+
+	// Render templates before writing headers so errors can still be reported as a 500
+	var rendered []byte
+	if resp.BodyTemplate != "" {
+		out, err := renderBodyTemplate(resp.BodyTemplate, r, params)
+		if err != nil {
+			lg.Errorf("  ✗ Error rendering body template: %v", err)
+			writeJSONError(w, http.StatusInternalServerError, "failed to render body template")
+			return
+		}
+		rendered = out
+	}
+
+	// Start from the default Content-Type, then apply server-wide headers and finally
+	// the response's own, so later layers can override earlier ones (including Content-Type)
+	w.Header().Set("Content-Type", defaultContentType(resp))
+	if resp.SSE != nil {
+		w.Header().Set("Cache-Control", "no-cache")
+	}
+	for key, value := range h.server.DefaultHeaders {
+		w.Header().Set(key, value)
+	}
+	// Response headers can use path parameters, e.g. a Location of /api/users/{id}
+	for key, value := range resp.Headers {
+		w.Header().Set(key, renderString(value, params))
+	}
+	for _, spec := range resp.SetCookies {
+		http.SetCookie(w, spec.cookie())
+	}
+	// Strip headers last, setting them to nil so net/http doesn't fill in its own
+	// Content-Type or Date instead
+	for _, name := range resp.RemoveHeaders {
+		w.Header()[http.CanonicalHeaderKey(name)] = nil
+	}
+
+	// Buffer the body to compute an ETag if enabled, so conditional requests can get
+	// a 304. Streamed, SSE and dripped bodies are sent as they are written, so they get none
+	var etag *etagWriter
+	if (resp.ETag || h.server.ETag) && resp.Stream == nil && resp.SSE == nil && resp.DripMs == 0 {
+		etag = newETagWriter(w, r)
+		w = etag
+	}
 
 	// Write status code
-	w.WriteHeader(route.Response.Status)
+	w.WriteHeader(resp.statusCode())
+
+	// Drip the body out slowly if configured, falling back to a normal write
+	// when the connection can't be flushed
+	var out io.Writer = w
+	if resp.DripMs > 0 {
+		if dw := newDripWriter(w, r, resp); dw != nil {
+			out = dw
+		} else {
+			lg.Errorf("  ✗ Response writer doesn't support flushing, sending body normally")
+		}
+	}
 
-	// Write response body
-	if route.Response.Body != nil {
-		if err := json.NewEncoder(w).Encode(route.Response.Body); err != nil {
-			log.Printf("  ✗ Error encoding response: %v", err)
+	// Write response body, streaming from disk when a body file is configured
+	if resp.Stream != nil {
+		interval := time.Duration(resp.StreamIntervalMs) * time.Millisecond
+		if err := writeStream(r.Context(), out, http.NewResponseController(w), resp.Stream, interval, params); err != nil {
+			lg.Errorf("  ✗ Stream interrupted: %v", err)
+			return
+		}
+	} else if resp.SSE != nil {
+		interval := time.Duration(resp.SSEIntervalMs) * time.Millisecond
+		if err := writeSSE(r.Context(), out, http.NewResponseController(w), resp.SSE, interval, resp.SSELoop, params); err != nil {
+			lg.Errorf("  ✗ Event stream interrupted: %v", err)
+			return
+		}
+	} else if bodyFile != nil {
+		if _, err := io.Copy(out, bodyFile); err != nil {
+			lg.Errorf("  ✗ Error streaming body file: %v", err)
+			return
+		}
+	} else if rendered != nil {
+		if _, err := out.Write(rendered); err != nil {
+			lg.Errorf("  ✗ Error writing response: %v", err)
+			return
+		}
+	} else if resp.BodyBase64 != "" {
+		// Already checked at startup, so decoding can't fail
+		data, _ := base64.StdEncoding.DecodeString(resp.BodyBase64)
+		if _, err := out.Write(data); err != nil {
+			lg.Errorf("  ✗ Error writing response: %v", err)
 			return
 		}
+	} else if resp.BodyXML != nil {
+		if err := writeXMLBody(out, resp.BodyXML, params); err != nil {
+			lg.Errorf("  ✗ Error encoding XML response: %v", err)
+			return
+		}
+	} else if resp.BodyRaw != "" {
+		if _, err := io.WriteString(out, renderString(resp.BodyRaw, params)); err != nil {
+			lg.Errorf("  ✗ Error writing response: %v", err)
+			return
+		}
+	} else if resp.Body != nil {
+		body := renderBody(resp.Body, params)
+		mergeRequestValues(body, resp.MergeFromRequest, r, params)
+
+		// String bodies for non-JSON content types (CSV, HTML, ...) are written verbatim
+		if text, ok := body.(string); ok && !isJSONContentType(w.Header().Get("Content-Type")) {
+			if _, err := io.WriteString(out, text); err != nil {
+				lg.Errorf("  ✗ Error writing response: %v", err)
+				return
+			}
+		} else if err := json.NewEncoder(out).Encode(body); err != nil {
+			lg.Errorf("  ✗ Error encoding response: %v", err)
+			return
+		}
+	}
+
+	status := resp.statusCode()
+	if etag != nil {
+		sent, err := etag.finish()
+		if err != nil {
+			lg.Errorf("  ✗ Error writing response: %v", err)
+			return
+		}
+		if sent == http.StatusNotModified {
+			lg.Printf("  ✓ ETag %s matches If-None-Match, not modified", w.Header().Get("ETag"))
+		}
+		status = sent
 	}
 
-	log.Printf("  ✓ Response sent: %d", route.Response.Status)
+	lg.Printf("  ✓ Response sent: %d (%d bytes in %v)", status, bytesWritten(w), lg.Elapsed())
 }
 
-// findRoute searches for a matching route based on method and path
-// Supports path parameters in the format /api/users/{id}
-func (h *MockHandler) findRoute(method, path string) *Route {
+// captureState stores the request values named by the route's capture, skipping
+// any the request doesn't have
+func (h *MockHandler) captureState(r *http.Request, route *Route, params map[string]string) {
+	lg := loggerFrom(r)
+	for key, source := range route.Capture {
+		value, ok := requestValue(source, r, params)
+		if !ok {
+			lg.Debugf("  … Nothing to capture for state.%s from %s", key, source)
+			continue
+		}
+		h.store.SetValue(key, value)
+		lg.Printf("  ✓ Captured state.%s = %s", key, value)
+	}
+}
+
+// withState returns the params with the captured state values added as state.<key>
+// entries, for {{state.<key>}} placeholders
+func (h *MockHandler) withState(params map[string]string) map[string]string {
+	values := h.store.Values()
+	if len(values) == 0 {
+		return params
+	}
+	merged := maps.Clone(params)
+	if merged == nil {
+		merged = make(map[string]string, len(values))
+	}
+	for key, value := range values {
+		merged[statePrefix+key] = value
+	}
+	return merged
+}
+
+// findRoute searches for a matching route based on method, path, query and body
+// Supports path parameters in the format /api/users/{id}, which are returned by name
+// Routes with a higher priority are preferred over all others. Among equal priorities,
+// the most specific path wins, so /users/me is preferred over /users/{id}. After that,
+// routes for a specific method are preferred over wildcard method routes, and routes
+// with query, cookie, body or form constraints are preferred over routes without them
+// Routes with maxHits stop matching once they have been matched that many times
+func (h *MockHandler) findRoute(r *http.Request) (*Route, map[string]string) {
+	// Routes are swapped wholesale on reload, so a snapshot stays valid after
+	// unlocking. Matching can read the request body, so it happens outside the lock
+	// where a slow upload can't hold up a reload and every request queued behind it
+	h.mu.RLock()
+	routes := h.routes
+	h.mu.RUnlock()
+
+	for {
+		route, params := h.matchRoute(r, routes)
+		// A concurrent request may have used up the route's last hit since it was
+		// matched, in which case matching again falls through to the next route
+		if route == nil || h.takeHit(route) {
+			return route, params
+		}
+	}
+}
+
+// matchRoute picks the best of the routes for the request
+func (h *MockHandler) matchRoute(r *http.Request, routes []Route) (*Route, map[string]string) {
+	// Routes are relative to the base path, so anything outside it can't match
+	path, ok := h.stripBasePath(r.URL.Path)
+	if !ok {
+		return nil, nil
+	}
+
+	query := r.URL.Query()
+
+	// The JSON or form body is only decoded once, and only if a route needs it
+	var body map[string]interface{}
+	bodyDecoded := false
+	var form url.Values
+	formDecoded := false
+
+	var best *Route
+	var bestParams map[string]string
+	bestScore := 0
+	for i := range routes {
+		route := &routes[i]
+		if !route.isEnabled() || !route.matchesMethod(r.Method) || h.exhausted(route) {
+			continue
+		}
+		params, ok := pathMatches(route.Path, path, h.pathOptions())
+		if !ok {
+			continue
+		}
+		if !queryMatches(route.Query, query) {
+			continue
+		}
+		if !queryPresent(route.QueryPresent, query) {
+			continue
+		}
+		if route.ContentType != "" && !contentTypeMatches(route.ContentType, r.Header.Get("Content-Type")) {
+			continue
+		}
+		if !cookiesMatch(route.CookieMatch, r) {
+			continue
+		}
+		if route.RequireTLS != nil && *route.RequireTLS != (r.TLS != nil) {
+			continue
+		}
+		if len(route.BodyMatch) > 0 {
+			if !bodyDecoded {
+				body = decodeJSONBody(r)
+				bodyDecoded = true
+			}
+			if !bodyMatches(route.BodyMatch, body) {
+				continue
+			}
+		}
+		if len(route.FormMatch) > 0 {
+			if !formDecoded {
+				form = decodeFormBody(r)
+				formDecoded = true
+			}
+			if !formMatches(route.FormMatch, form) {
+				continue
+			}
+		}
+
+		// A higher priority always wins, then the more specific path, then the better
+		// score. Earlier routes win ties, so only replace on a strictly better route
+		score := 0
+		if !route.isAnyMethod() {
+			score += 2
+		}
+		if route.hasMatchers() {
+			score++
+		}
+		if best == nil {
+			best, bestParams, bestScore = route, params, score
+			continue
+		}
+		better := cmp.Or(
+			cmp.Compare(route.Priority, best.Priority),
+			comparePathSpecificity(route.Path, best.Path),
+			cmp.Compare(score, bestScore),
+		)
+		if better > 0 {
+			best, bestParams, bestScore = route, params, score
+		}
+	}
+	return best, bestParams
+}
+
+// comparePathSpecificity compares how specific two route paths are, returning a
+// positive number if a is more specific than b. More static segments win, then
+// more typed parameters such as {id:int}, and paths ending in a wildcard lose to
+// those that don't. A regex can't be ranked against other paths, so routes with
+// one compare as equal and keep their config order
+func comparePathSpecificity(a, b string) int {
+	if strings.HasPrefix(a, regexPrefix) || strings.HasPrefix(b, regexPrefix) {
+		return 0
+	}
+	aStatic, aTyped, aOpen := pathSpecificity(a)
+	bStatic, bTyped, bOpen := pathSpecificity(b)
+	return cmp.Or(
+		cmp.Compare(aStatic, bStatic),
+		cmp.Compare(aTyped, bTyped),
+		cmp.Compare(bOpen, aOpen),
+	)
+}
+
+// pathSpecificity counts a route path's static segments and typed parameters,
+// and reports whether it ends in a wildcard
+func pathSpecificity(path string) (static, typed, open int) {
+	for _, segment := range strings.Split(strings.Trim(path, "/"), "/") {
+		if _, typ, ok := parseParam(segment); ok {
+			if typ != "" {
+				typed++
+			}
+			continue
+		}
+		if segment == "*" {
+			open = 1
+			continue
+		}
+		if segment != "" {
+			static++
+		}
+	}
+	return static, typed, open
+}
+
+// exhausted reports whether a route with maxHits has been matched that many times
+func (h *MockHandler) exhausted(route *Route) bool {
+	if route.MaxHits == 0 {
+		return false
+	}
+	h.stateMu.Lock()
+	defer h.stateMu.Unlock()
+	return h.hits[route] >= route.MaxHits
+}
+
+// takeHit counts a match against a route with maxHits, returning false if the
+// route has no hits left
+func (h *MockHandler) takeHit(route *Route) bool {
+	if route.MaxHits == 0 {
+		return true
+	}
+	h.stateMu.Lock()
+	defer h.stateMu.Unlock()
+	if h.hits[route] >= route.MaxHits {
+		return false
+	}
+	h.hits[route]++
+	return true
+}
+
+// allowedMethods lists the methods of enabled routes whose path matches the request
+// It returns nil if no route has the path, or if one with the request's method does
+// (meaning a query or body matcher failed rather than the method)
+func (h *MockHandler) allowedMethods(r *http.Request) []string {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	path, ok := h.stripBasePath(r.URL.Path)
+	if !ok {
+		return nil
+	}
+
+	var allowed []string
 	for i := range h.routes {
 		route := &h.routes[i]
-		if route.Method == method && pathMatches(route.Path, path) {
-			return route
+		if !route.isEnabled() {
+			continue
+		}
+		if _, ok := pathMatches(route.Path, path, h.pathOptions()); !ok {
+			continue
+		}
+		if route.matchesMethod(r.Method) {
+			return nil
+		}
+		for _, method := range route.methods() {
+			if !slices.Contains(allowed, method) {
+				allowed = append(allowed, method)
+			}
+		}
+	}
+	return allowed
+}
+
+// publicPath returns the path clients use to reach a route, under the base path
+// Regex paths are returned as configured, since they match the path after the base
+// path is removed
+func (h *MockHandler) publicPath(path string) string {
+	if h.server.BasePath == "" || strings.HasPrefix(path, regexPrefix) {
+		return path
+	}
+	if path == "/" {
+		return h.server.BasePath
+	}
+	return h.server.BasePath + path
+}
+
+// stripBasePath removes the configured base path prefix from a request path
+// It returns false if the path is outside the base path
+func (h *MockHandler) stripBasePath(path string) (string, bool) {
+	base := h.server.BasePath
+	if base == "" {
+		return path, true
+	}
+	if path == base {
+		return "/", true
+	}
+	if strings.HasPrefix(path, base+"/") {
+		return path[len(base):], true
+	}
+	return "", false
+}
+
+// queryMatches checks that every expected key/value pair is present in the query
+// Extra query parameters on the request are ignored
+func queryMatches(expected map[string]string, query url.Values) bool {
+	for key, value := range expected {
+		values, ok := query[key]
+		if !ok || !slices.Contains(values, value) {
+			return false
+		}
+	}
+	return true
+}
+
+// queryPresent checks that every listed key appears in the query, with any value
+func queryPresent(keys []string, query url.Values) bool {
+	for _, key := range keys {
+		if !query.Has(key) {
+			return false
+		}
+	}
+	return true
+}
+
+// contentTypeMatches compares media types, ignoring parameters such as charset
+func contentTypeMatches(expected, actual string) bool {
+	actualType, _, err := mime.ParseMediaType(actual)
+	if err != nil {
+		return false
+	}
+	expectedType, _, err := mime.ParseMediaType(expected)
+	if err != nil {
+		expectedType = expected
+	}
+	return strings.EqualFold(expectedType, actualType)
+}
+
+// bodyMatches checks that every expected key is present in the body with an equal value
+func bodyMatches(expected, body map[string]interface{}) bool {
+	if body == nil {
+		return false
+	}
+	for key, value := range expected {
+		actual, ok := body[key]
+		if !ok || !reflect.DeepEqual(actual, value) {
+			return false
 		}
 	}
-	return nil
+	return true
+}
+
+// formMatches checks that every expected field is present in the form with the given value
+func formMatches(expected map[string]string, form url.Values) bool {
+	if form == nil {
+		return false
+	}
+	return queryMatches(expected, form)
+}
+
+// decodeFormBody parses a URL-encoded form body, returning nil for other content types
+// The body is parsed from a buffered copy so it can still be read afterwards
+func decodeFormBody(r *http.Request) url.Values {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "application/x-www-form-urlencoded" {
+		return nil
+	}
+
+	data, err := bufferBody(r)
+	if err != nil {
+		return nil
+	}
+
+	form, err := url.ParseQuery(string(data))
+	if err != nil {
+		return nil
+	}
+	return form
+}
+
+// decodeJSONBody decodes the request body as a JSON object, returning nil if it isn't one
+// The body is restored afterwards so it can be read again
+func decodeJSONBody(r *http.Request) map[string]interface{} {
+	data, err := bufferBody(r)
+	if err != nil || len(data) == 0 {
+		return nil
+	}
+
+	var body map[string]interface{}
+	if err := json.Unmarshal(data, &body); err != nil {
+		return nil
+	}
+	return body
+}
+
+// bufferBody reads the full request body and replaces it with an in-memory copy
+// so that later readers still see the original content
+func bufferBody(r *http.Request) ([]byte, error) {
+	if r.Body == nil || r.Body == http.NoBody {
+		return nil, nil
+	}
+
+	data, err := io.ReadAll(r.Body)
+	r.Body.Close()
+	r.Body = io.NopCloser(bytes.NewReader(data))
+	return data, err
+}
+
+// pathOptions controls how request paths are compared against route patterns
+type pathOptions struct {
+	caseInsensitive bool
+	strictSlash     bool
+}
+
+// pathOptions returns the path matching options from the server config
+func (h *MockHandler) pathOptions() pathOptions {
+	return pathOptions{
+		caseInsensitive: h.server.CaseInsensitivePaths,
+		strictSlash:     h.server.StrictSlash,
+	}
 }
 
 // pathMatches checks if a request path matches a route pattern
-// Supports path parameters like /api/users/{id}
-func pathMatches(pattern, path string) bool {
+// Supports path parameters like /api/users/{id}, returning the captured values by name
+// A trailing wildcard like /static/* matches one or more remaining segments
+// Patterns starting with ~ are treated as regular expressions
+func pathMatches(pattern, path string, opts pathOptions) (map[string]string, bool) {
+	// Regex patterns are handled separately from the segment logic
+	if strings.HasPrefix(pattern, regexPrefix) {
+		if opts.caseInsensitive {
+			pattern = regexPrefix + "(?i)" + strings.TrimPrefix(pattern, regexPrefix)
+		}
+		return regexPathMatches(pattern, path)
+	}
+
+	// Unless strict, /users and /users/ are treated as the same path
+	if !opts.strictSlash {
+		pattern = trimTrailingSlash(pattern)
+		path = trimTrailingSlash(path)
+	}
+
 	// Try exact match first (faster for static routes)
-	if pattern == path {
-		return true
+	if opts.segmentEqual(pattern, path) {
+		return nil, true
 	}
 
-	// Check if pattern contains parameters
-	if !strings.Contains(pattern, "{") {
-		return false
+	// Check if pattern contains parameters or a trailing wildcard
+	wildcard := strings.HasSuffix(pattern, "/*")
+	if !wildcard && !strings.Contains(pattern, "{") {
+		return nil, false
 	}
 
 	// Split both paths into segments
 	patternParts := strings.Split(strings.Trim(pattern, "/"), "/")
 	pathParts := strings.Split(strings.Trim(path, "/"), "/")
 
+	params := make(map[string]string)
+
+	// A trailing * matches one or more remaining segments, captured as the "*" param
+	if wildcard {
+		patternParts = patternParts[:len(patternParts)-1]
+		if len(pathParts) <= len(patternParts) || strings.Trim(path, "/") == "" {
+			return nil, false
+		}
+		params["*"] = strings.Join(pathParts[len(patternParts):], "/")
+		pathParts = pathParts[:len(patternParts)]
+	}
+
 	// Must have same number of segments
 	if len(patternParts) != len(pathParts) {
-		return false
+		return nil, false
 	}
 
 	// Compare each segment
@@ -109,23 +1109,192 @@ func pathMatches(pattern, path string) bool {
 		patternPart := patternParts[i]
 		pathPart := pathParts[i]
 
-		// If pattern segment is a parameter (e.g., {id}), it matches anything
-		if strings.HasPrefix(patternPart, "{") && strings.HasSuffix(patternPart, "}") {
+		// If pattern segment is a parameter (e.g., {id}), it matches anything,
+		// unless it is typed (e.g., {id:int}) and the segment doesn't fit the type
+		if name, typ, ok := parseParam(patternPart); ok {
+			if !paramMatches(typ, pathPart) {
+				return nil, false
+			}
+			params[name] = pathPart
 			continue
 		}
 
 		// Otherwise, must be exact match
-		if patternPart != pathPart {
-			return false
+		if !opts.segmentEqual(patternPart, pathPart) {
+			return nil, false
 		}
 	}
 
-	return true
+	return params, true
+}
+
+// segmentEqual compares static path text, ignoring case if configured
+// Parameter values are always captured with their original case
+func (opts pathOptions) segmentEqual(pattern, path string) bool {
+	if opts.caseInsensitive {
+		return strings.EqualFold(pattern, path)
+	}
+	return pattern == path
+}
+
+// trimTrailingSlash removes a trailing slash from a path, leaving the root path alone
+func trimTrailingSlash(path string) string {
+	if len(path) > 1 {
+		return strings.TrimSuffix(path, "/")
+	}
+	return path
+}
+
+// regexPathMatches tests a path against a ~ prefixed regex pattern
+// Named capture groups are returned as path parameters
+func regexPathMatches(pattern, path string) (map[string]string, bool) {
+	re, err := compilePathRegex(pattern)
+	if err != nil {
+		return nil, false
+	}
+
+	match := re.FindStringSubmatch(path)
+	if match == nil {
+		return nil, false
+	}
+
+	params := make(map[string]string)
+	for i, name := range re.SubexpNames() {
+		if name != "" {
+			params[name] = match[i]
+		}
+	}
+	return params, true
+}
+
+// compilePathRegex compiles a ~ prefixed regex pattern, caching the result by pattern
+func compilePathRegex(pattern string) (*regexp.Regexp, error) {
+	regexCacheMu.RLock()
+	re, ok := regexCache[pattern]
+	regexCacheMu.RUnlock()
+	if ok {
+		return re, nil
+	}
+
+	re, err := regexp.Compile(strings.TrimPrefix(pattern, regexPrefix))
+	if err != nil {
+		return nil, err
+	}
+
+	regexCacheMu.Lock()
+	regexCache[pattern] = re
+	regexCacheMu.Unlock()
+	return re, nil
+}
+
+// defaultContentType returns the Content-Type a response gets unless its headers
+// set one: JSON, NDJSON for streams, event streams for SSE, raw bytes for base64
+// bodies and XML for XML bodies
+func defaultContentType(resp *Response) string {
+	switch {
+	case resp.Stream != nil:
+		return ndjsonContentType
+	case resp.SSE != nil:
+		return sseContentType
+	case resp.BodyBase64 != "":
+		return "application/octet-stream"
+	case resp.BodyXML != nil:
+		return xmlContentType
+	}
+	return "application/json"
+}
+
+// responseDelay returns how long to wait before sending a response.
+// A delayDistribution takes precedence, then a delayMinMs/delayMaxMs range,
+// then a fixed delayMs. Sampled delays are clamped to be non-negative.
+func responseDelay(resp *Response) time.Duration {
+	mean, stddev := float64(resp.DelayMeanMs), float64(resp.DelayStdDevMs)
+	switch resp.DelayDistribution {
+	case delayNormal:
+		return sampledDelay(rand.NormFloat64()*stddev + mean)
+	case delayExponential:
+		return sampledDelay(rand.ExpFloat64() * mean)
+	}
+	if resp.DelayMaxMs > 0 {
+		ms := resp.DelayMinMs + rand.Intn(resp.DelayMaxMs-resp.DelayMinMs+1)
+		return time.Duration(ms) * time.Millisecond
+	}
+	return time.Duration(resp.DelayMs) * time.Millisecond
+}
+
+// sampledDelay converts a sampled delay in milliseconds to a duration, never negative
+func sampledDelay(ms float64) time.Duration {
+	return time.Duration(max(ms, 0) * float64(time.Millisecond))
 }
 
-// healthCheckHandler provides a simple health check endpoint
-func healthCheckHandler(w http.ResponseWriter, r *http.Request) {
+// sleepContext waits for the given duration or until the context is done.
+// It returns false if the context was cancelled before the delay elapsed.
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// isJSONContentType reports whether a Content-Type header value is JSON,
+// including structured syntax types like application/problem+json
+func isJSONContentType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+// writeErrorBody writes a configured JSON body with the given status, falling
+// back to a standard {"error": ...} body when none is configured
+func writeErrorBody(w http.ResponseWriter, status int, body interface{}, message string) {
+	if body == nil {
+		writeJSONError(w, status, message)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+// writeJSONError writes a JSON error envelope with the given status code
+func writeJSONError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": message})
+}
+
+// healthCheckHandler provides a simple health check endpoint, using the configured
+// status and body if there are any
+func (h *MockHandler) healthCheckHandler(w http.ResponseWriter, r *http.Request) {
+	// Report not ready until the startup delay has passed, like a slow-starting service
+	if wait := time.Until(h.readyAt); wait > 0 {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprintf(w, `{"status":"starting","message":"mockery-api is starting"}`)
+		return
+	}
+
+	health := h.server.Health
+	if health == nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprintf(w, `{"status":"ok","message":"mockery-api is running"}`)
+		return
+	}
+
+	status := health.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	fmt.Fprintf(w, `{"status":"ok","message":"mockery-api is running"}`)
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(health.Body)
 }
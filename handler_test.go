@@ -0,0 +1,1051 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/tls"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/andybalholm/brotli"
+)
+
+// loadTestConfig writes the config to a temporary file and loads it as the
+// server would
+func loadTestConfig(t *testing.T, config string) *Config {
+	t.Helper()
+	filename := filepath.Join(t.TempDir(), "config.json")
+	writeTestFile(t, filename, config)
+	loaded, err := LoadConfig(filename)
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	return loaded
+}
+
+// readTestFile returns a file's contents as a string
+func readTestFile(t *testing.T, filename string) string {
+	t.Helper()
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+// writeTestFile creates a file with the given contents
+func writeTestFile(t *testing.T, filename, data string) {
+	t.Helper()
+	if err := os.WriteFile(filename, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// newTestHandler builds a handler serving the config
+func newTestHandler(t *testing.T, config string) *MockHandler {
+	t.Helper()
+	return NewMockHandler(loadTestConfig(t, config))
+}
+
+// doRequest sends a request through the handler and returns the recorded response
+func doRequest(h http.Handler, method, target, body string, headers ...string) *httptest.ResponseRecorder {
+	var r *http.Request
+	if body == "" {
+		r = httptest.NewRequest(method, target, nil)
+	} else {
+		r = httptest.NewRequest(method, target, strings.NewReader(body))
+	}
+	for i := 0; i+1 < len(headers); i += 2 {
+		r.Header.Set(headers[i], headers[i+1])
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func TestUncommonStatusPassesThrough(t *testing.T) {
+	h := newTestHandler(t, `{
+		"server": {"port": 8080},
+		"routes": [
+			{"method": "GET", "path": "/custom", "response": {"status": 299, "body": {"ok": true}}},
+			{"method": "GET", "path": "/teapot", "response": {"status": 418}}
+		]
+	}`)
+
+	if w := doRequest(h, "GET", "/custom", ""); w.Code != 299 || w.Body.String() != `{"ok":true}`+"\n" {
+		t.Errorf("GET /custom: %d %q, want 299 with the configured body", w.Code, w.Body.String())
+	}
+	if w := doRequest(h, "GET", "/teapot", ""); w.Code != http.StatusTeapot {
+		t.Errorf("GET /teapot: status %d, want 418", w.Code)
+	}
+}
+
+func TestOmittedStatusDefaultsTo200(t *testing.T) {
+	h := newTestHandler(t, `{
+		"server": {"port": 8080},
+		"routes": [
+			{"method": "GET", "path": "/plain", "response": {"body": {"ok": true}}},
+			{"method": "GET", "path": "/weighted", "weightedResponses": [{"weight": 1, "response": {"body": "w"}}]},
+			{"method": "GET", "path": "/gap", "responseByHitCount": [{"from": 2, "response": {"status": 201}}]}
+		],
+		"defaultResponse": {"body": {"error": "none"}}
+	}`)
+
+	for _, path := range []string{"/plain", "/weighted", "/gap", "/missing"} {
+		if w := doRequest(h, "GET", path, ""); w.Code != http.StatusOK {
+			t.Errorf("GET %s: status %d, want 200", path, w.Code)
+		}
+	}
+	if w := doRequest(h, "GET", "/gap", ""); w.Code != http.StatusCreated {
+		t.Errorf("second GET /gap: status %d, want 201", w.Code)
+	}
+}
+
+func TestStatefulTypedIDSharesCollection(t *testing.T) {
+	h := newTestHandler(t, `{
+		"server": {"port": 8080},
+		"routes": [
+			{"method": "POST", "path": "/users", "stateful": true, "response": {"status": 201}},
+			{"method": "GET", "path": "/users/{id:int}", "stateful": true, "response": {"status": 200}}
+		]
+	}`)
+
+	if w := doRequest(h, "POST", "/users", `{"name": "Ada"}`, "Content-Type", "application/json"); w.Code != http.StatusCreated {
+		t.Fatalf("POST /users: status %d, want 201", w.Code)
+	}
+	w := doRequest(h, "GET", "/users/1", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET /users/1: status %d, want 200", w.Code)
+	}
+	if !strings.Contains(w.Body.String(), `"Ada"`) {
+		t.Errorf("GET /users/1: body %s, want the created user", w.Body.String())
+	}
+}
+
+func TestAdminPathsIncludeBasePath(t *testing.T) {
+	h := newTestHandler(t, `{
+		"server": {"port": 8080, "basePath": "/api/v1"},
+		"routes": [
+			{"method": "GET", "path": "/users/{id}", "response": {"status": 200}},
+			{"method": "GET", "path": "~^/orders/\\d+$", "response": {"status": 200}}
+		]
+	}`)
+
+	for name, handler := range map[string]http.HandlerFunc{"/_routes": h.routesHandler, "/_contract": h.contractHandler} {
+		body := doRequest(handler, "GET", name, "").Body.String()
+		if !strings.Contains(body, `"path":"/api/v1/users/{id}"`) {
+			t.Errorf("%s: %s, want the path under the base path", name, body)
+		}
+		if !strings.Contains(body, `"path":"~^/orders/\\d+$"`) {
+			t.Errorf("%s: %s, want the regex path as configured", name, body)
+		}
+	}
+	if w := doRequest(h, "GET", "/api/v1/users/7", ""); w.Code != http.StatusOK {
+		t.Errorf("GET /api/v1/users/7: status %d, want 200", w.Code)
+	}
+}
+
+func TestMostSpecificPathWins(t *testing.T) {
+	h := newTestHandler(t, `{
+		"server": {"port": 8080},
+		"routes": [
+			{"method": "GET", "path": "/api/*", "response": {"status": 200, "body": "wildcard"}},
+			{"method": "GET", "path": "/api/users/{id}", "response": {"status": 200, "body": "param"}},
+			{"method": "GET", "path": "/api/users/{id:int}", "response": {"status": 200, "body": "typed"}},
+			{"method": "GET", "path": "/api/users/me", "response": {"status": 200, "body": "static"}}
+		]
+	}`)
+
+	tests := map[string]string{
+		"/api/users/me":  "static",
+		"/api/users/42":  "typed",
+		"/api/users/bob": "param",
+		"/api/orders":    "wildcard",
+	}
+	for path, want := range tests {
+		if got := doRequest(h, "GET", path, "").Body.String(); !strings.Contains(got, want) {
+			t.Errorf("GET %s: body %s, want %s", path, got, want)
+		}
+	}
+}
+
+func TestRegexRoutesKeepConfigOrder(t *testing.T) {
+	h := newTestHandler(t, `{
+		"server": {"port": 8080},
+		"routes": [
+			{"method": "GET", "path": "~^/users/\\d+$", "response": {"status": 200, "body": "regex"}},
+			{"method": "GET", "path": "/users/{id}", "response": {"status": 200, "body": "param"}}
+		]
+	}`)
+
+	if got := doRequest(h, "GET", "/users/7", "").Body.String(); !strings.Contains(got, "regex") {
+		t.Errorf("GET /users/7: body %s, want the earlier regex route", got)
+	}
+	if got := doRequest(h, "GET", "/users/bob", "").Body.String(); !strings.Contains(got, "param") {
+		t.Errorf("GET /users/bob: body %s, want the param route", got)
+	}
+}
+
+func TestPriorityOverridesSpecificityAndOrder(t *testing.T) {
+	h := newTestHandler(t, `{
+		"server": {"port": 8080},
+		"routes": [
+			{"method": "GET", "path": "/api/users/me", "response": {"status": 200, "body": "static"}},
+			{"method": "GET", "path": "/api/users/{id}", "response": {"status": 200, "body": "param"}},
+			{"method": "*", "path": "/api/*", "priority": 1, "query": {"maintenance": "true"}, "response": {"status": 503, "body": "maintenance"}},
+			{"method": "GET", "path": "/api/*", "priority": -1, "response": {"status": 404, "body": "fallback"}}
+		]
+	}`)
+
+	tests := []struct {
+		path   string
+		status int
+	}{
+		{"/api/users/me", http.StatusOK},
+		{"/api/users/me?maintenance=true", http.StatusServiceUnavailable},
+		{"/api/users/42", http.StatusOK},
+		{"/api/orders", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		if w := doRequest(h, "GET", tt.path, ""); w.Code != tt.status {
+			t.Errorf("GET %s: status %d, want %d", tt.path, w.Code, tt.status)
+		}
+	}
+}
+
+func TestCompressionNegotiation(t *testing.T) {
+	h := newTestHandler(t, `{
+		"server": {"port": 8080, "compression": true},
+		"routes": [{"method": "GET", "path": "/users", "response": {"status": 200, "body": [{"name": "Ada"}]}}]
+	}`)
+
+	tests := map[string]string{
+		"gzip, deflate, br":    "br",
+		"br;q=1.0, gzip;q=0.5": "br",
+		"br;q=0.5, gzip;q=0.8": "gzip",
+		"gzip":                 "gzip",
+		"gzip;q=0, br":         "br",
+		"*":                    "br",
+		"gzip;q=0.5, *;q=0.1":  "gzip",
+		"identity":             "",
+		"br;q=0, gzip;q=0, *":  "",
+	}
+	for accept, want := range tests {
+		w := doRequest(h, "GET", "/users", "", "Accept-Encoding", accept)
+		if got := w.Header().Get("Content-Encoding"); got != want {
+			t.Errorf("Accept-Encoding %q: Content-Encoding %q, want %q", accept, got, want)
+			continue
+		}
+
+		var body io.Reader = w.Body
+		switch want {
+		case encodingBrotli:
+			body = brotli.NewReader(w.Body)
+		case encodingGzip:
+			zr, err := gzip.NewReader(w.Body)
+			if err != nil {
+				t.Fatalf("Accept-Encoding %q: %v", accept, err)
+			}
+			body = zr
+		}
+		data, err := io.ReadAll(body)
+		if err != nil {
+			t.Errorf("Accept-Encoding %q: decoding body: %v", accept, err)
+		} else if got := string(data); got != `[{"name":"Ada"}]`+"\n" {
+			t.Errorf("Accept-Encoding %q: body %q", accept, got)
+		}
+	}
+}
+
+// blockingReader signals when it's first read, then blocks until released
+type blockingReader struct {
+	reading chan struct{}
+	release chan struct{}
+	once    sync.Once
+	data    io.Reader
+}
+
+func (b *blockingReader) Read(p []byte) (int, error) {
+	b.once.Do(func() { close(b.reading) })
+	<-b.release
+	return b.data.Read(p)
+}
+
+func TestSlowBodyDoesNotBlockReload(t *testing.T) {
+	config := `{
+		"server": {"port": 8080},
+		"routes": [{"method": "POST", "path": "/users", "bodyMatch": {"role": "admin"}, "response": {"status": 201}}]
+	}`
+	h := newTestHandler(t, config)
+
+	body := &blockingReader{reading: make(chan struct{}), release: make(chan struct{}), data: strings.NewReader(`{"role": "admin"}`)}
+	r := httptest.NewRequest("POST", "/users", body)
+	w := httptest.NewRecorder()
+	served := make(chan struct{})
+	go func() {
+		h.ServeHTTP(w, r)
+		close(served)
+	}()
+	<-body.reading
+
+	reloaded := make(chan struct{})
+	go func() {
+		h.Reload(loadTestConfig(t, config))
+		close(reloaded)
+	}()
+	select {
+	case <-reloaded:
+	case <-time.After(time.Second):
+		t.Error("Reload blocked while a request body was being read")
+	}
+
+	close(body.release)
+	<-served
+	if w.Code != http.StatusCreated {
+		t.Errorf("POST /users: status %d, want 201", w.Code)
+	}
+}
+
+func TestRoutesDifferingByMatchersCountedApart(t *testing.T) {
+	h := newTestHandler(t, `{
+		"server": {"port": 8080},
+		"routes": [
+			{"method": "GET", "path": "/users", "query": {"role": "admin"}, "rateLimit": {"requestsPerSecond": 0.1}, "response": {"status": 200}},
+			{"method": "GET", "path": "/users", "rateLimit": {"requestsPerSecond": 0.1}, "response": {"status": 200}}
+		]
+	}`)
+
+	for _, path := range []string{"/users?role=admin", "/users", "/users"} {
+		doRequest(h, "GET", path, "")
+	}
+	if w := doRequest(h, "GET", "/users?role=admin", ""); w.Code != http.StatusTooManyRequests {
+		t.Errorf("second admin request: status %d, want 429", w.Code)
+	}
+
+	body := doRequest(http.HandlerFunc(h.metricsHandler), "GET", "/_metrics", "").Body.String()
+	for _, want := range []string{`"GET /users (route 0)":2`, `"GET /users (route 1)":2`} {
+		if !strings.Contains(body, want) {
+			t.Errorf("/_metrics: %s, want %s", body, want)
+		}
+	}
+}
+
+func TestQueryMatching(t *testing.T) {
+	h := newTestHandler(t, `{
+		"server": {"port": 8080},
+		"routes": [
+			{"method": "GET", "path": "/search", "response": {"status": 200, "body": "any"}},
+			{"method": "GET", "path": "/search", "query": {"type": "user"}, "response": {"status": 200, "body": "user"}},
+			{"method": "GET", "path": "/search", "query": {"type": "product", "sort": "price"}, "response": {"status": 200, "body": "product"}}
+		]
+	}`)
+
+	tests := map[string]string{
+		"/search":                             "any",
+		"/search?type=user":                   "user",
+		"/search?type=user&page=2":            "user",
+		"/search?type=product":                "any",
+		"/search?sort=price&type=product":     "product",
+		"/search?type=product&sort=name":      "any",
+		"/search?type=product&sort=price&x=1": "product",
+	}
+	for path, want := range tests {
+		if got := doRequest(h, "GET", path, "").Body.String(); got != `"`+want+`"`+"\n" {
+			t.Errorf("GET %s: body %s, want %q", path, got, want)
+		}
+	}
+}
+
+func TestAuthToken(t *testing.T) {
+	h := newTestHandler(t, `{
+		"server": {"port": 8080},
+		"routes": [
+			{"method": "GET", "path": "/bearer", "requiresAuth": true, "authHeader": "Authorization", "authToken": "secret", "response": {"status": 200}},
+			{"method": "GET", "path": "/key", "requiresAuth": true, "authHeader": "X-API-Key", "authToken": "secret", "response": {"status": 200}},
+			{"method": "GET", "path": "/present", "requiresAuth": true, "authHeader": "X-API-Key", "response": {"status": 200}}
+		]
+	}`)
+
+	tests := []struct {
+		path    string
+		headers []string
+		status  int
+	}{
+		{"/bearer", []string{"Authorization", "Bearer secret"}, http.StatusOK},
+		{"/bearer", []string{"Authorization", "Bearer wrong"}, http.StatusUnauthorized},
+		{"/bearer", nil, http.StatusUnauthorized},
+		{"/key", []string{"X-API-Key", "secret"}, http.StatusOK},
+		{"/key", []string{"X-API-Key", "wrong"}, http.StatusUnauthorized},
+		{"/present", []string{"X-API-Key", "anything"}, http.StatusOK},
+		{"/present", nil, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		if w := doRequest(h, "GET", tt.path, "", tt.headers...); w.Code != tt.status {
+			t.Errorf("GET %s with %v: status %d, want %d", tt.path, tt.headers, w.Code, tt.status)
+		}
+	}
+}
+
+func TestWildcardPaths(t *testing.T) {
+	h := newTestHandler(t, `{
+		"server": {"port": 8080},
+		"routes": [{"method": "GET", "path": "/static/*", "response": {"status": 200}}]
+	}`)
+
+	tests := map[string]int{
+		"/static/app.css":        http.StatusOK,
+		"/static/css/app.css":    http.StatusOK,
+		"/static/a/b/c/logo.png": http.StatusOK,
+		"/static":                http.StatusNotFound,
+		"/static/":               http.StatusNotFound,
+		"/other/static/app.css":  http.StatusNotFound,
+	}
+	for path, want := range tests {
+		if w := doRequest(h, "GET", path, ""); w.Code != want {
+			t.Errorf("GET %s: status %d, want %d", path, w.Code, want)
+		}
+	}
+}
+
+func TestSequencedResponsesCycle(t *testing.T) {
+	h := newTestHandler(t, `{
+		"server": {"port": 8080},
+		"routes": [{"method": "GET", "path": "/job", "responses": [
+			{"status": 202, "body": "pending"},
+			{"status": 202, "body": "pending"},
+			{"status": 200, "body": "complete"}
+		]}]
+	}`)
+
+	want := []int{202, 202, 200, 202, 202, 200, 202}
+	for i, status := range want {
+		if w := doRequest(h, "GET", "/job", ""); w.Code != status {
+			t.Errorf("request %d: status %d, want %d", i+1, w.Code, status)
+		}
+	}
+}
+
+func TestCaseInsensitivePaths(t *testing.T) {
+	routes := `"routes": [{"method": "GET", "path": "/users/{id}", "response": {"status": 200, "body": {"id": "{id}"}}}]`
+	strict := newTestHandler(t, `{"server": {"port": 8080}, `+routes+`}`)
+	lenient := newTestHandler(t, `{"server": {"port": 8080, "caseInsensitivePaths": true}, `+routes+`}`)
+
+	if w := doRequest(strict, "GET", "/Users/AbC", ""); w.Code != http.StatusNotFound {
+		t.Errorf("case-sensitive GET /Users/AbC: status %d, want 404", w.Code)
+	}
+	w := doRequest(lenient, "GET", "/USERS/AbC", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("case-insensitive GET /USERS/AbC: status %d, want 200", w.Code)
+	}
+	if !strings.Contains(w.Body.String(), `"AbC"`) {
+		t.Errorf("case-insensitive GET /USERS/AbC: body %s, want the parameter's original case", w.Body.String())
+	}
+}
+
+func TestConfiguredContentTypeRespected(t *testing.T) {
+	h := newTestHandler(t, `{
+		"server": {"port": 8080},
+		"routes": [
+			{"method": "GET", "path": "/report.csv", "response": {"status": 200, "headers": {"Content-Type": "text/csv"}, "body": "id,name\n1,Ada\n"}},
+			{"method": "GET", "path": "/users", "response": {"status": 200, "body": {"name": "Ada"}}}
+		]
+	}`)
+
+	w := doRequest(h, "GET", "/report.csv", "")
+	if got := w.Header().Get("Content-Type"); got != "text/csv" {
+		t.Errorf("CSV route: Content-Type %q, want text/csv", got)
+	}
+	if got := w.Body.String(); got != "id,name\n1,Ada\n" {
+		t.Errorf("CSV route: body %q, want it written verbatim", got)
+	}
+
+	w = doRequest(h, "GET", "/users", "")
+	if got := w.Header().Get("Content-Type"); got != "application/json" {
+		t.Errorf("JSON route: Content-Type %q, want application/json", got)
+	}
+}
+
+func TestConditionalResponses(t *testing.T) {
+	h := newTestHandler(t, `{
+		"server": {"port": 8080},
+		"routes": [{"method": "GET", "path": "/greeting",
+			"when": [
+				{"header": "Accept-Language", "value": "fr", "response": {"status": 200, "body": "bonjour"}},
+				{"header": "X-Tenant", "value": "acme", "response": {"status": 200, "body": "hello acme"}},
+				{"header": "Accept-Language", "value": "fr", "response": {"status": 200, "body": "shadowed"}}
+			],
+			"response": {"status": 200, "body": "hello"}
+		}]
+	}`)
+
+	tests := []struct {
+		headers []string
+		want    string
+	}{
+		{[]string{"Accept-Language", "fr"}, "bonjour"},
+		{[]string{"X-Tenant", "acme"}, "hello acme"},
+		{[]string{"Accept-Language", "fr", "X-Tenant", "acme"}, "bonjour"},
+		{[]string{"Accept-Language", "de"}, "hello"},
+		{nil, "hello"},
+	}
+	for _, tt := range tests {
+		if got := doRequest(h, "GET", "/greeting", "", tt.headers...).Body.String(); got != `"`+tt.want+`"`+"\n" {
+			t.Errorf("headers %v: body %s, want %q", tt.headers, got, tt.want)
+		}
+	}
+}
+
+func TestFormMatching(t *testing.T) {
+	h := newTestHandler(t, `{
+		"server": {"port": 8080},
+		"routes": [
+			{"method": "POST", "path": "/login", "formMatch": {"username": "ada"}, "response": {"status": 200, "headers": {"Content-Type": "text/plain"}, "bodyTemplate": "{{.Body}}"}},
+			{"method": "POST", "path": "/login", "response": {"status": 401}}
+		]
+	}`)
+
+	const formType = "application/x-www-form-urlencoded"
+	w := doRequest(h, "POST", "/login", "username=ada&password=secret", "Content-Type", formType)
+	if w.Code != http.StatusOK {
+		t.Fatalf("matching form: status %d, want 200", w.Code)
+	}
+	if got := w.Body.String(); got != "username=ada&password=secret" {
+		t.Errorf("matching form: body %q, want the request body still readable", got)
+	}
+	if w := doRequest(h, "POST", "/login", "username=bob", "Content-Type", formType); w.Code != http.StatusUnauthorized {
+		t.Errorf("other username: status %d, want 401", w.Code)
+	}
+	if w := doRequest(h, "POST", "/login", `{"username": "ada"}`, "Content-Type", "application/json"); w.Code != http.StatusUnauthorized {
+		t.Errorf("JSON body: status %d, want 401", w.Code)
+	}
+}
+
+func TestTimestampAndUUIDPlaceholders(t *testing.T) {
+	h := newTestHandler(t, `{
+		"server": {"port": 8080},
+		"routes": [{"method": "POST", "path": "/users", "response": {"status": 201, "body": {"id": "{{uuid}}", "createdAt": "{{now}}"}}}]
+	}`)
+
+	var ids []string
+	for range 2 {
+		var body struct {
+			ID        string `json:"id"`
+			CreatedAt string `json:"createdAt"`
+		}
+		if err := json.Unmarshal(doRequest(h, "POST", "/users", "").Body.Bytes(), &body); err != nil {
+			t.Fatal(err)
+		}
+		if !paramMatches("uuid", body.ID) {
+			t.Errorf("id %q, want a UUID", body.ID)
+		}
+		created, err := time.Parse(time.RFC3339, body.CreatedAt)
+		if err != nil {
+			t.Errorf("createdAt %q, want an RFC 3339 time: %v", body.CreatedAt, err)
+		} else if age := time.Since(created); age < -time.Second || age > 5*time.Second {
+			t.Errorf("createdAt %s, want the current time", body.CreatedAt)
+		}
+		ids = append(ids, body.ID)
+	}
+	if ids[0] == ids[1] {
+		t.Errorf("both requests got id %s, want a fresh UUID per request", ids[0])
+	}
+}
+
+func TestQueryPresent(t *testing.T) {
+	h := newTestHandler(t, `{
+		"server": {"port": 8080},
+		"routes": [
+			{"method": "GET", "path": "/items", "response": {"status": 200, "body": "normal"}},
+			{"method": "GET", "path": "/items", "query": {"view": "full"}, "queryPresent": ["debug"], "response": {"status": 200, "body": "full debug"}},
+			{"method": "GET", "path": "/items", "queryPresent": ["debug"], "response": {"status": 200, "body": "debug"}}
+		]
+	}`)
+
+	tests := map[string]string{
+		"/items":                  "normal",
+		"/items?debug":            "debug",
+		"/items?debug=":           "debug",
+		"/items?debug=1":          "debug",
+		"/items?view=full":        "normal",
+		"/items?view=full&debug":  "full debug",
+		"/items?verbose&view=min": "normal",
+	}
+	for path, want := range tests {
+		if got := doRequest(h, "GET", path, "").Body.String(); got != `"`+want+`"`+"\n" {
+			t.Errorf("GET %s: body %s, want %q", path, got, want)
+		}
+	}
+}
+
+func TestWeightedResponsesDistribution(t *testing.T) {
+	h := newTestHandler(t, `{
+		"server": {"port": 8080},
+		"routes": [{"method": "GET", "path": "/flaky", "weightedResponses": [
+			{"weight": 3, "response": {"status": 200}},
+			{"weight": 1, "response": {"status": 503}}
+		]}]
+	}`)
+
+	const requests = 4000
+	ok := 0
+	for range requests {
+		switch w := doRequest(h, "GET", "/flaky", ""); w.Code {
+		case http.StatusOK:
+			ok++
+		case http.StatusServiceUnavailable:
+		default:
+			t.Fatalf("status %d, want 200 or 503", w.Code)
+		}
+	}
+	// The chance of straying this far from 75% by chance is negligible
+	if share := float64(ok) / requests; share < 0.70 || share > 0.80 {
+		t.Errorf("%.1f%% of responses were 200, want about 75%%", share*100)
+	}
+}
+
+func TestTrailingSlashes(t *testing.T) {
+	routes := `"routes": [
+		{"method": "GET", "path": "/users", "response": {"status": 200}},
+		{"method": "GET", "path": "/teams/", "response": {"status": 200}}
+	]`
+	lenient := newTestHandler(t, `{"server": {"port": 8080}, `+routes+`}`)
+	strict := newTestHandler(t, `{"server": {"port": 8080, "strictSlash": true}, `+routes+`}`)
+
+	tests := []struct {
+		path            string
+		lenient, strict int
+	}{
+		{"/users", http.StatusOK, http.StatusOK},
+		{"/users/", http.StatusOK, http.StatusNotFound},
+		{"/teams/", http.StatusOK, http.StatusOK},
+		{"/teams", http.StatusOK, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		if w := doRequest(lenient, "GET", tt.path, ""); w.Code != tt.lenient {
+			t.Errorf("GET %s: status %d, want %d", tt.path, w.Code, tt.lenient)
+		}
+		if w := doRequest(strict, "GET", tt.path, ""); w.Code != tt.strict {
+			t.Errorf("GET %s with strictSlash: status %d, want %d", tt.path, w.Code, tt.strict)
+		}
+	}
+}
+
+func TestMaxBodyBytes(t *testing.T) {
+	h := newTestHandler(t, `{
+		"server": {"port": 8080, "maxBodyBytes": 16},
+		"routes": [{"method": "POST", "path": "/upload", "response": {"status": 201}}]
+	}`)
+
+	if w := doRequest(h, "POST", "/upload", "small body"); w.Code != http.StatusCreated {
+		t.Errorf("small body: status %d, want 201", w.Code)
+	}
+	w := doRequest(h, "POST", "/upload", strings.Repeat("x", 17))
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("oversized body: status %d, want 413", w.Code)
+	}
+	if !strings.Contains(w.Body.String(), "request body too large") {
+		t.Errorf("oversized body: body %s, want the error message", w.Body.String())
+	}
+}
+
+func TestContentTypeMatching(t *testing.T) {
+	h := newTestHandler(t, `{
+		"server": {"port": 8080},
+		"routes": [
+			{"method": "POST", "path": "/orders", "contentType": "application/json", "response": {"status": 200, "body": "json"}},
+			{"method": "POST", "path": "/orders", "contentType": "application/xml", "response": {"status": 200, "body": "xml"}},
+			{"method": "POST", "path": "/orders", "response": {"status": 200, "body": "any"}}
+		]
+	}`)
+
+	tests := map[string]string{
+		"application/json":                "json",
+		"application/json; charset=utf-8": "json",
+		"Application/XML":                 "xml",
+		"text/plain":                      "any",
+		"":                                "any",
+	}
+	for contentType, want := range tests {
+		if got := doRequest(h, "POST", "/orders", "{}", "Content-Type", contentType).Body.String(); got != `"`+want+`"`+"\n" {
+			t.Errorf("Content-Type %q: body %s, want %q", contentType, got, want)
+		}
+	}
+}
+
+func TestTypedPathParams(t *testing.T) {
+	h := newTestHandler(t, `{
+		"server": {"port": 8080},
+		"routes": [
+			{"method": "GET", "path": "/users/{id:int}", "response": {"status": 200, "body": "int"}},
+			{"method": "GET", "path": "/users/{slug:alpha}", "response": {"status": 200, "body": "alpha"}},
+			{"method": "GET", "path": "/orders/{ref:uuid}", "response": {"status": 200, "body": "uuid"}}
+		]
+	}`)
+
+	tests := map[string]string{
+		"/users/42":       "int",
+		"/users/settings": "alpha",
+		"/orders/123e4567-e89b-12d3-a456-426614174000": "uuid",
+	}
+	for path, want := range tests {
+		if got := doRequest(h, "GET", path, "").Body.String(); got != `"`+want+`"`+"\n" {
+			t.Errorf("GET %s: body %s, want %q", path, got, want)
+		}
+	}
+	for _, path := range []string{"/users/v2", "/users/4a", "/orders/42", "/orders/123e4567-e89b-12d3-a456"} {
+		if w := doRequest(h, "GET", path, ""); w.Code != http.StatusNotFound {
+			t.Errorf("GET %s: status %d, want 404", path, w.Code)
+		}
+	}
+}
+
+func TestMethodNotAllowedAndNotFound(t *testing.T) {
+	routes := `"routes": [
+		{"method": "GET", "path": "/users", "response": {"status": 200}},
+		{"method": "POST", "path": "/users", "response": {"status": 201}}
+	]`
+	h := newTestHandler(t, `{"server": {"port": 8080}, `+routes+`}`)
+
+	w := doRequest(h, "DELETE", "/users", "")
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("DELETE /users: status %d, want 405", w.Code)
+	}
+	if got := w.Header().Get("Allow"); got != "GET, POST" {
+		t.Errorf("DELETE /users: Allow %q, want \"GET, POST\"", got)
+	}
+	if got := w.Body.String(); !strings.Contains(got, "method not allowed") {
+		t.Errorf("DELETE /users: body %s, want the default error", got)
+	}
+	if w := doRequest(h, "GET", "/teams", ""); w.Code != http.StatusNotFound {
+		t.Errorf("GET /teams: status %d, want 404", w.Code)
+	}
+
+	custom := newTestHandler(t, `{"server": {"port": 8080,
+		"notFoundBody": {"error": "no such mock"},
+		"methodNotAllowedBody": {"error": "wrong method"}
+	}, `+routes+`}`)
+	if got := doRequest(custom, "DELETE", "/users", "").Body.String(); !strings.Contains(got, "wrong method") {
+		t.Errorf("custom 405 body %s, want the configured body", got)
+	}
+	w = doRequest(custom, "GET", "/teams", "")
+	if w.Code != http.StatusNotFound || !strings.Contains(w.Body.String(), "no such mock") {
+		t.Errorf("custom 404: %d %s, want 404 with the configured body", w.Code, w.Body.String())
+	}
+}
+
+func TestETagConditionalRequests(t *testing.T) {
+	h := newTestHandler(t, `{
+		"server": {"port": 8080},
+		"routes": [
+			{"method": "GET", "path": "/users", "response": {"status": 200, "etag": true, "body": [{"name": "Ada"}]}},
+			{"method": "GET", "path": "/plain", "response": {"status": 200, "body": "no etag"}}
+		]
+	}`)
+
+	w := doRequest(h, "GET", "/users", "")
+	etag := w.Header().Get("ETag")
+	if w.Code != http.StatusOK || etag == "" {
+		t.Fatalf("first request: status %d with ETag %q, want 200 with an ETag", w.Code, etag)
+	}
+
+	w = doRequest(h, "GET", "/users", "", "If-None-Match", etag)
+	if w.Code != http.StatusNotModified {
+		t.Errorf("matching If-None-Match: status %d, want 304", w.Code)
+	}
+	if w.Body.Len() != 0 {
+		t.Errorf("matching If-None-Match: body %q, want none", w.Body.String())
+	}
+	if w := doRequest(h, "GET", "/users", "", "If-None-Match", `"stale"`); w.Code != http.StatusOK {
+		t.Errorf("stale If-None-Match: status %d, want 200", w.Code)
+	}
+	if got := doRequest(h, "GET", "/plain", "").Header().Get("ETag"); got != "" {
+		t.Errorf("route without etag: ETag %q, want none", got)
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	h := newTestHandler(t, `{
+		"server": {"port": 8080, "requestId": true},
+		"routes": [{"method": "GET", "path": "/users", "response": {"status": 200}}]
+	}`)
+
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	w := doRequest(h, "GET", "/users", "", "X-Request-Id", "trace-123")
+	if got := w.Header().Get("X-Request-Id"); got != "trace-123" {
+		t.Errorf("X-Request-Id %q, want the supplied trace-123", got)
+	}
+	for _, line := range strings.Split(strings.TrimSpace(logs.String()), "\n") {
+		if !strings.Contains(line, "trace-123") {
+			t.Errorf("log line %q, want the request id", line)
+		}
+	}
+
+	if got := doRequest(h, "GET", "/users", "").Header().Get("X-Request-Id"); got == "" {
+		t.Error("no X-Request-Id generated for a request without one")
+	}
+}
+
+func TestHeaderPlaceholders(t *testing.T) {
+	h := newTestHandler(t, `{
+		"server": {"port": 8080},
+		"routes": [{"method": "POST", "path": "/api/users/{id}", "response": {"status": 201, "headers": {"Location": "/api/users/{id}"}}}]
+	}`)
+
+	w := doRequest(h, "POST", "/api/users/42", "")
+	if w.Code != http.StatusCreated {
+		t.Fatalf("status %d, want 201", w.Code)
+	}
+	if got := w.Header().Get("Location"); got != "/api/users/42" {
+		t.Errorf("Location %q, want /api/users/42", got)
+	}
+}
+
+func TestStartupDelayHealthTransition(t *testing.T) {
+	h := newTestHandler(t, `{
+		"server": {"port": 8080, "startupDelayMs": 100},
+		"routes": [{"method": "GET", "path": "/users", "response": {"status": 200}}]
+	}`)
+	health := http.HandlerFunc(h.healthCheckHandler)
+
+	w := doRequest(health, "GET", "/_health", "")
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("health while starting: status %d, want 503", w.Code)
+	}
+	if got := w.Header().Get("Retry-After"); got != "1" {
+		t.Errorf("health while starting: Retry-After %q, want 1", got)
+	}
+	if w := doRequest(h, "GET", "/users", ""); w.Code != http.StatusOK {
+		t.Errorf("mock route while starting: status %d, want 200", w.Code)
+	}
+
+	time.Sleep(150 * time.Millisecond)
+	if w := doRequest(health, "GET", "/_health", ""); w.Code != http.StatusOK {
+		t.Errorf("health after the delay: status %d, want 200", w.Code)
+	}
+}
+
+func TestRequireTLS(t *testing.T) {
+	h := newTestHandler(t, `{
+		"server": {"port": 8080},
+		"routes": [
+			{"method": "GET", "path": "/account", "requireTls": false, "response": {"status": 301, "headers": {"Location": "https://localhost:8443/account"}}},
+			{"method": "GET", "path": "/account", "requireTls": true, "response": {"status": 200}}
+		]
+	}`)
+
+	if w := doRequest(h, "GET", "/account", ""); w.Code != http.StatusMovedPermanently {
+		t.Errorf("plaintext request: status %d, want 301", w.Code)
+	}
+
+	r := httptest.NewRequest("GET", "https://localhost:8443/account", nil)
+	if r.TLS == nil {
+		r.TLS = &tls.ConnectionState{}
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Errorf("TLS request: status %d, want 200", w.Code)
+	}
+}
+
+func TestResponseByHitCountBoundaries(t *testing.T) {
+	h := newTestHandler(t, `{
+		"server": {"port": 8080},
+		"routes": [{"method": "GET", "path": "/status", "responseByHitCount": [
+			{"from": 1, "to": 3, "response": {"status": 503}},
+			{"from": 4, "to": 4, "response": {"status": 429}},
+			{"from": 6, "response": {"status": 200}}
+		], "response": {"status": 202}}]
+	}`)
+
+	want := []int{503, 503, 503, 429, 202, 200, 200}
+	for i, status := range want {
+		if w := doRequest(h, "GET", "/status", ""); w.Code != status {
+			t.Errorf("request %d: status %d, want %d", i+1, w.Code, status)
+		}
+	}
+
+	h.Reset()
+	if w := doRequest(h, "GET", "/status", ""); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("first request after reset: status %d, want 503", w.Code)
+	}
+}
+
+func TestRemoveHeaders(t *testing.T) {
+	h := newTestHandler(t, `{
+		"server": {"port": 8080, "defaultHeaders": {"X-Powered-By": "mockery"}},
+		"routes": [{"method": "GET", "path": "/bare", "response": {"status": 200,
+			"headers": {"X-Debug": "1", "X-Keep": "yes"},
+			"removeHeaders": ["x-powered-by", "X-Debug", "Content-Type"],
+			"bodyRaw": "plain"
+		}}]
+	}`)
+
+	w := doRequest(h, "GET", "/bare", "")
+	// Removed headers are left as nil entries, which net/http doesn't send
+	for _, name := range []string{"X-Powered-By", "X-Debug", "Content-Type"} {
+		if values := w.Header()[name]; len(values) > 0 {
+			t.Errorf("%s: %q, want the header removed", name, values)
+		}
+	}
+	if got := w.Header().Get("X-Keep"); got != "yes" {
+		t.Errorf("X-Keep %q, want unlisted headers kept", got)
+	}
+}
+
+// concurrentStatuses fires n requests at once and returns their statuses, sorted
+func concurrentStatuses(h http.Handler, n int, path string) []int {
+	statuses := make([]int, n)
+	var wg sync.WaitGroup
+	for i := range n {
+		wg.Go(func() {
+			statuses[i] = doRequest(h, "GET", path, "").Code
+		})
+	}
+	wg.Wait()
+	slices.Sort(statuses)
+	return statuses
+}
+
+func TestMaxConcurrent(t *testing.T) {
+	routes := `"routes": [{"method": "GET", "path": "/slow", "response": {"status": 200, "delayMs": 100}}]`
+
+	rejecting := newTestHandler(t, `{"server": {"port": 8080, "maxConcurrent": 2}, `+routes+`}`)
+	if got, want := concurrentStatuses(rejecting, 4, "/slow"), []int{200, 200, 503, 503}; !slices.Equal(got, want) {
+		t.Errorf("without queueing: statuses %v, want %v", got, want)
+	}
+
+	queueing := newTestHandler(t, `{"server": {"port": 8080, "maxConcurrent": 2, "queueWhenBusy": true}, `+routes+`}`)
+	start := time.Now()
+	if got, want := concurrentStatuses(queueing, 4, "/slow"), []int{200, 200, 200, 200}; !slices.Equal(got, want) {
+		t.Errorf("with queueing: statuses %v, want %v", got, want)
+	}
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond {
+		t.Errorf("with queueing: took %v, want at least two rounds of 100ms", elapsed)
+	}
+}
+
+func TestRequestSchema(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "address.json"), `{"type": "object", "required": ["city"]}`)
+	writeTestFile(t, filepath.Join(dir, "config.json"), `{"server": {"port": 8080}, "routes": [
+		{"method": "POST", "path": "/users", "response": {"status": 201},
+		 "requestSchema": {
+		  "$schema": "https://json-schema.org/draft/2020-12/schema", "title": "User",
+		  "type": "object", "required": ["email"],
+		  "properties": {
+		   "email": {"type": "string", "format": "email"},
+		   "age": {"type": "integer", "minimum": 0, "multipleOf": 1},
+		   "tags": {"type": "array", "uniqueItems": true, "items": {"$ref": "#/$defs/tag"}},
+		   "address": {"$ref": "address.json"}
+		  },
+		  "patternProperties": {"^x-": {"type": "string"}},
+		  "$defs": {"tag": {"type": "string", "minLength": 1}}
+		 }}
+	]}`)
+	config, err := LoadConfig(filepath.Join(dir, "config.json"))
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	h := NewMockHandler(config)
+
+	valid := `{"email": "ada@example.com", "age": 36, "tags": ["admin"], "address": {"city": "London"}, "x-source": "test"}`
+	if w := doRequest(h, "POST", "/users", valid, "Content-Type", "application/json"); w.Code != http.StatusCreated {
+		t.Fatalf("valid body: status %d, want 201: %s", w.Code, w.Body)
+	}
+
+	tests := map[string]string{
+		`{"age": 1}`:                                       `"/: missing`,
+		`{"email": "not-an-email"}`:                        `"/email`,
+		`{"email": "ada@example.com", "age": -1}`:          `"/age`,
+		`{"email": "ada@example.com", "tags": ["a", "a"]}`: `"/tags`,
+		`{"email": "ada@example.com", "tags": [""]}`:       `"/tags/0`,
+		`{"email": "ada@example.com", "address": {}}`:      `"/address`,
+		`{"email": "ada@example.com", "x-source": 1}`:      `"/x-source`,
+	}
+	for body, location := range tests {
+		w := doRequest(h, "POST", "/users", body, "Content-Type", "application/json")
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("body %s: status %d, want 400", body, w.Code)
+			continue
+		}
+		if !strings.Contains(w.Body.String(), "request body does not match schema") || !strings.Contains(w.Body.String(), location) {
+			t.Errorf("body %s: response %s, want a violation at %s", body, w.Body, location)
+		}
+	}
+
+	if w := doRequest(h, "POST", "/users", "{", "Content-Type", "application/json"); w.Code != http.StatusBadRequest {
+		t.Errorf("malformed body: status %d, want 400", w.Code)
+	}
+}
+
+func TestRequestFieldPlaceholders(t *testing.T) {
+	h := newTestHandler(t, `{
+		"server": {"port": 8080},
+		"routes": [
+			{"method": "POST", "path": "/orders/{id}", "response": {"status": 201,
+			 "headers": {"X-Customer": "{{req.customer.name}}"},
+			 "body": {"message": "{id}: {{req.customer.name}} ordered {{req.items.0.sku}} {{req.note}}"}}}
+		]
+	}`)
+
+	// Values are inserted once, so placeholders inside them are left alone whatever
+	// order the fields are substituted in
+	body := `{"customer": {"name": "{{req.items.0.sku}}"}, "items": [{"sku": "A1"}], "note": "{id}"}`
+	for range 20 {
+		w := doRequest(h, "POST", "/orders/42", body, "Content-Type", "application/json")
+		if got, want := w.Body.String(), `{"message":"42: {{req.items.0.sku}} ordered A1 {id}"}`+"\n"; got != want {
+			t.Fatalf("body %s, want %s", got, want)
+		}
+		if got := w.Header().Get("X-Customer"); got != "{{req.items.0.sku}}" {
+			t.Fatalf("X-Customer %q, want the customer name as sent", got)
+		}
+	}
+
+	routes := loadTestConfig(t, `{"server": {"port": 8080}, "routes": [
+		{"method": "POST", "path": "/a", "response": {"status": 200, "body": {"id": "{id}", "at": "{{now}}"}}},
+		{"method": "POST", "path": "/b", "response": {"status": 200, "body": [{"nested": ["{{req.id}}"]}]}},
+		{"method": "POST", "path": "/c", "response": {"status": 200, "headers": {"X-Id": "{{req.id}}"}}},
+		{"method": "POST", "path": "/d", "response": {"status": 200, "sse": [{"data": {"id": "{{req.id}}"}}]}}
+	]}`).Routes
+	for i, want := range []bool{false, true, true, true} {
+		if got := routes[i].Response.usesRequestFields(); got != want {
+			t.Errorf("route %s: usesRequestFields %v, want %v", routes[i].Path, got, want)
+		}
+	}
+}
+
+func TestContractHidesCredentials(t *testing.T) {
+	h := newTestHandler(t, `{
+		"server": {"port": 8080},
+		"routes": [
+			{"method": "GET", "path": "/token", "requiresAuth": true, "authHeader": "X-Api-Key", "authToken": "s3cret-token", "response": {"status": 200}},
+			{"method": "GET", "path": "/basic", "requiresAuth": true, "authType": "basic", "username": "admin", "password": "s3cret-password", "response": {"status": 200}}
+		]
+	}`)
+
+	body := doRequest(http.HandlerFunc(h.contractHandler), "GET", "/_contract", "").Body.String()
+	for _, secret := range []string{"s3cret-token", "admin", "s3cret-password"} {
+		if strings.Contains(body, secret) {
+			t.Errorf("/_contract exposes %q: %s", secret, body)
+		}
+	}
+	for _, want := range []string{`"auth":{"type":"header","header":"X-Api-Key"}`, `"auth":{"type":"basic","header":"Authorization"}`} {
+		if !strings.Contains(body, want) {
+			t.Errorf("/_contract: %s, want %s", body, want)
+		}
+	}
+}
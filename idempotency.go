@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"time"
+)
+
+// idempotencyKeyHeader carries the key clients send to make a request safe to retry
+const idempotencyKeyHeader = "Idempotency-Key"
+
+// idempotencyKey identifies a cached response by route and Idempotency-Key value
+type idempotencyKey struct {
+	route *Route
+	key   string
+}
+
+// cachedResponse is a response recorded for an Idempotency-Key, replayed on
+// later requests with the same key until it expires
+type cachedResponse struct {
+	status  int
+	header  http.Header
+	body    []byte
+	expires time.Time
+}
+
+// cachedIdempotent returns the unexpired response recorded for the key, if any
+func (h *MockHandler) cachedIdempotent(route *Route, key string) *cachedResponse {
+	h.stateMu.Lock()
+	defer h.stateMu.Unlock()
+
+	id := idempotencyKey{route, key}
+	cached, ok := h.idempotent[id]
+	if !ok {
+		return nil
+	}
+	if !cached.expires.IsZero() && time.Now().After(cached.expires) {
+		delete(h.idempotent, id)
+		return nil
+	}
+	return cached
+}
+
+// storeIdempotent records the response for the key, keeping the first one if
+// concurrent requests with the same key both got through
+// Nothing is stored if no response was sent, e.g. when the connection was dropped
+func (h *MockHandler) storeIdempotent(route *Route, key string, cw *idempotencyWriter) {
+	if cw.header == nil {
+		return
+	}
+	cached := &cachedResponse{status: cw.status, header: cw.header, body: cw.body.Bytes()}
+	if route.IdempotencyTTLMs > 0 {
+		cached.expires = time.Now().Add(time.Duration(route.IdempotencyTTLMs) * time.Millisecond)
+	}
+
+	h.stateMu.Lock()
+	defer h.stateMu.Unlock()
+	id := idempotencyKey{route, key}
+	if _, ok := h.idempotent[id]; !ok {
+		h.idempotent[id] = cached
+	}
+}
+
+// replay writes a cached response, marking it with Idempotent-Replayed
+// Headers already set for this request, such as its X-Request-Id, are kept
+func (c *cachedResponse) replay(w http.ResponseWriter) {
+	header := w.Header()
+	for name, values := range c.header {
+		if _, ok := header[name]; !ok {
+			header[name] = values
+		}
+	}
+	header.Set("Idempotent-Replayed", "true")
+	w.WriteHeader(c.status)
+	w.Write(c.body)
+}
+
+// idempotencyWriter passes a response through while keeping a copy of its
+// status, headers and body to replay later
+type idempotencyWriter struct {
+	http.ResponseWriter
+	status int
+	header http.Header
+	body   bytes.Buffer
+}
+
+// newIdempotencyWriter wraps w, defaulting the status to 200 as net/http does
+func newIdempotencyWriter(w http.ResponseWriter) *idempotencyWriter {
+	return &idempotencyWriter{ResponseWriter: w, status: http.StatusOK}
+}
+
+// WriteHeader snapshots the headers and status as they are sent
+func (cw *idempotencyWriter) WriteHeader(status int) {
+	if cw.header == nil {
+		cw.status = status
+		cw.header = cw.Header().Clone()
+	}
+	cw.ResponseWriter.WriteHeader(status)
+}
+
+// Write copies the body as it's written
+func (cw *idempotencyWriter) Write(p []byte) (int, error) {
+	if cw.header == nil {
+		cw.WriteHeader(http.StatusOK)
+	}
+	cw.body.Write(p)
+	return cw.ResponseWriter.Write(p)
+}
+
+// Unwrap returns the underlying writer, for http.ResponseController
+func (cw *idempotencyWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Supported values for ServerConfig.LogFormat
+const (
+	logFormatText = "text"
+	logFormatJSON = "json"
+)
+
+// Supported values for ServerConfig.LogLevel, from most to least verbose
+const (
+	logLevelDebug = "debug"
+	logLevelInfo  = "info"
+	logLevelError = "error"
+)
+
+// logLevels ranks the log levels so lines below the configured level can be dropped
+var logLevels = map[string]int{
+	logLevelDebug: 0,
+	logLevelInfo:  1,
+	logLevelError: 2,
+}
+
+// logger writes the log output for a single request
+// In text mode each line is printed as it happens; in json mode the lines are
+// collected and emitted as one structured object when the request finishes.
+// Lines logged before the route is known are held back until Matched is called,
+// so quiet routes can drop them.
+type logger struct {
+	json     bool
+	level    int
+	start    time.Time
+	method   string
+	path     string
+	client   string
+	id       string
+	events   []string
+	pending  []string
+	resolved bool
+	quiet    bool
+	failed   bool
+}
+
+// logEntry is the structured object emitted per request in json mode
+type logEntry struct {
+	Time       time.Time `json:"time"`
+	Method     string    `json:"method"`
+	Path       string    `json:"path"`
+	ClientIP   string    `json:"clientIp,omitempty"`
+	RequestID  string    `json:"requestId,omitempty"`
+	Matched    bool      `json:"matched"`
+	Route      string    `json:"route,omitempty"`
+	Status     int       `json:"status"`
+	Bytes      int64     `json:"bytes"`
+	DurationMs float64   `json:"durationMs"`
+	Events     []string  `json:"events,omitempty"`
+}
+
+type loggerKey struct{}
+
+// newLogger creates a logger for the request in the given format and level
+// An empty level logs at info, and a request id, if given, is added to every line
+func newLogger(format, level string, r *http.Request, client, id string) *logger {
+	rank, ok := logLevels[level]
+	if !ok {
+		rank = logLevels[logLevelInfo]
+	}
+	return &logger{
+		json:   format == logFormatJSON,
+		level:  rank,
+		start:  time.Now(),
+		method: r.Method,
+		path:   r.URL.Path,
+		client: client,
+		id:     id,
+	}
+}
+
+// withLogger attaches a logger to the request context
+func withLogger(r *http.Request, l *logger) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), loggerKey{}, l))
+}
+
+// loggerFrom returns the request's logger, falling back to a text logger
+func loggerFrom(r *http.Request) *logger {
+	if l, ok := r.Context().Value(loggerKey{}).(*logger); ok {
+		return l
+	}
+	l := newLogger(logFormatText, "", r, "", "")
+	l.resolved = true
+	return l
+}
+
+// Debugf logs a line that is only shown at the debug level
+func (l *logger) Debugf(format string, args ...interface{}) {
+	l.logf(logLevelDebug, format, args...)
+}
+
+// Printf logs a line for the request at the info level
+func (l *logger) Printf(format string, args ...interface{}) {
+	l.logf(logLevelInfo, format, args...)
+}
+
+// Errorf logs a failure for the request, shown at every level
+func (l *logger) Errorf(format string, args ...interface{}) {
+	l.logf(logLevelError, format, args...)
+}
+
+// logf logs a line if the level allows it
+func (l *logger) logf(level string, format string, args ...interface{}) {
+	if level == logLevelError {
+		l.failed = true
+	}
+	if l.quiet || logLevels[level] < l.level {
+		return
+	}
+
+	line := fmt.Sprintf(format, args...)
+	// Without the request line, failures need the request for context
+	if !l.json && l.level > logLevels[logLevelInfo] {
+		line = fmt.Sprintf("[%s] %s %s", l.method, l.path, strings.TrimSpace(line))
+	}
+	if !l.json && l.id != "" {
+		line = fmt.Sprintf("[%s] %s", l.id, line)
+	}
+	switch {
+	case l.json:
+		l.events = append(l.events, strings.TrimSpace(line))
+	case !l.resolved:
+		l.pending = append(l.pending, line)
+	default:
+		log.Print(line)
+	}
+}
+
+// Matched records the route the request matched (nil if none), releasing any held
+// back lines, or dropping them and silencing the rest of the request for quiet routes
+func (l *logger) Matched(route *Route) {
+	l.resolved = true
+	if route != nil && route.Quiet {
+		l.quiet = true
+		l.events, l.pending = nil, nil
+		return
+	}
+
+	for _, line := range l.pending {
+		log.Print(line)
+	}
+	l.pending = nil
+}
+
+// Elapsed returns how long the request has been running
+func (l *logger) Elapsed() time.Duration {
+	return time.Since(l.start).Round(time.Microsecond)
+}
+
+// Finish records the outcome of the request and the body bytes written, emitting
+// the json entry if enabled
+func (l *logger) Finish(route *Route, status int, bytes int64) {
+	// Requests rejected before matching still get their lines printed
+	if !l.resolved {
+		l.Matched(nil)
+	}
+	if !l.json || l.quiet {
+		return
+	}
+	// At the error level only requests that failed are worth an entry
+	if l.level == logLevels[logLevelError] && !l.failed {
+		return
+	}
+
+	entry := logEntry{
+		Time:       l.start.UTC(),
+		Method:     l.method,
+		Path:       l.path,
+		ClientIP:   l.client,
+		RequestID:  l.id,
+		Matched:    route != nil,
+		Status:     status,
+		Bytes:      bytes,
+		DurationMs: float64(l.Elapsed().Microseconds()) / 1000,
+		Events:     l.events,
+	}
+	if route != nil {
+		entry.Route = route.String()
+	}
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		log.Printf("Error encoding log entry: %v", err)
+		return
+	}
+	fmt.Fprintln(log.Writer(), string(line))
+}
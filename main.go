@@ -1,18 +1,55 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"crypto/tls"
 	"flag"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
 )
 
 func main() {
 	// Parse command line flags
-	configFile := flag.String("config", "config.json", "Path to configuration file")
+	configFile := flag.String("config", "config.json", "Path to configuration file, or - to read it from stdin")
+	flag.BoolVar(&strictEnv, "strict-env", false, "Fail if the config references unset ${VAR} environment variables")
+	watch := flag.Bool("watch", false, "Reload routes automatically when the config file changes")
+	validate := flag.Bool("validate", false, "Validate the config file and exit without starting the server")
+	record := flag.String("record", "", "Proxy every request to this upstream URL and record the responses as routes")
+	recordOutput := flag.String("record-output", "recorded.json", "File to write recorded routes to in -record mode")
+	recordPort := flag.Int("record-port", 3000, "Port to listen on in -record mode")
+	port := flag.Int("port", -1, "Port to listen on, overriding the config; 0 picks any free port")
+	dump := flag.String("dump", "", "Log every request in full: \"all\" for every request or \"unmatched\" for requests that match no route")
+	portFile := flag.String("port-file", "", "Write the listening port to this file once the server is bound")
+	generate := flag.String("generate", "", "Write curls, openapi or postman docs for the config and exit without starting the server")
+	generateOutput := flag.String("generate-output", "", "File to write -generate output to (default: ENDPOINTS.md, openapi.json or postman_collection.json)")
 	flag.Parse()
 
+	// In record mode, act as a recording proxy instead of serving a config
+	if *record != "" {
+		if err := runRecorder(*record, *recordOutput, *recordPort); err != nil {
+			log.Fatalf("Recording failed: %v", err)
+		}
+		return
+	}
+
+	// A config piped in on stdin can only be read once
+	if *watch && *configFile == stdinConfig {
+		log.Fatalf("-watch can't be used when reading the config from stdin")
+	}
+
 	// Load configuration
 	log.Printf("Loading configuration from: %s", *configFile)
 	config, err := LoadConfig(*configFile)
@@ -20,33 +57,366 @@ func main() {
 		log.Fatalf("Failed to load config: %v", err)
 	}
 
+	// Let -port override the configured port, e.g. 0 to run parallel instances in CI
+	if *port >= 0 {
+		if len(config.Servers) > 0 {
+			log.Fatalf("-port can't be used with a config that lists several servers")
+		}
+		if *port > 65535 {
+			log.Fatalf("Invalid -port: %d", *port)
+		}
+		config.Server.Port = *port
+	}
+
+	// Let -dump turn on request dumps for every server
+	if *dump != "" {
+		if *dump != dumpAll && *dump != dumpUnmatched {
+			log.Fatalf("Invalid -dump %q: must be %q or %q", *dump, dumpAll, dumpUnmatched)
+		}
+		for _, group := range config.serverGroups() {
+			group.Server.DumpRequests = *dump
+		}
+	}
+
+	// In generate mode, write docs for the loaded config instead of serving it
+	if *generate != "" {
+		if err := runGenerator(*generate, config, *configFile, *generateOutput); err != nil {
+			log.Fatalf("Generating %s failed: %v", *generate, err)
+		}
+		return
+	}
+
+	// In validate mode, report success and stop before binding a port
+	if *validate {
+		fmt.Printf("✓ %s is valid: %d routes validated\n", *configFile, config.routeCount())
+		return
+	}
+
+	// Send logs to a file instead of the console if configured
+	if file := config.logFile(); file != "" {
+		f, err := os.OpenFile(file, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			log.Fatalf("Failed to open log file: %v", err)
+		}
+		defer f.Close()
+		log.Printf("Logging to: %s", file)
+		log.SetOutput(f)
+	}
+
 	log.Printf("Configuration loaded successfully")
-	log.Printf("  - Port: %d", config.Server.Port)
-	log.Printf("  - Routes: %d configured", len(config.Routes))
 
-	// Create handler with configured routes
-	handler := NewMockHandler(config.Routes)
+	// Create a handler for each server, so every port serves its own routes
+	groups := config.serverGroups()
+	handlers := make([]*MockHandler, len(groups))
+	for i, group := range groups {
+		handlers[i] = NewMockHandler(group)
+
+		// Record requests to a JSONL file if configured
+		if group.Server.RequestLog != "" {
+			requestLog, err := newRequestLogger(group.Server.RequestLog)
+			if err != nil {
+				log.Fatalf("Failed to open request log: %v", err)
+			}
+			defer requestLog.Close()
+			handlers[i].requestLog = requestLog
+		}
+	}
+
+	// Watch config file for changes if requested
+	if *watch {
+		log.Printf("Watching %s for changes", *configFile)
+		go watchConfig(*configFile, handlers, time.Second)
+	}
+
+	// Remove a port file left by a previous run, so it's only present once bound
+	if *portFile != "" {
+		os.Remove(*portFile)
+	}
+
+	reload := reloadHandler(*configFile, handlers)
+	servers := make([]*http.Server, len(groups))
+	listeners := make([]net.Listener, len(groups))
+	for i, group := range groups {
+		servers[i], listeners[i], err = newServer(group, handlers[i], reload, config.httpsPort())
+		if err != nil {
+			log.Fatalf("Server failed to start: %v", err)
+		}
+	}
+
+	// Tell test harnesses which port was bound, e.g. with -port 0
+	if *portFile != "" {
+		if err := writePortFile(*portFile, listeners); err != nil {
+			log.Fatalf("Failed to write port file: %v", err)
+		}
+		log.Printf("Port written to: %s", *portFile)
+	}
+	log.Println("Press Ctrl+C to stop")
+	log.Println("---")
+
+	err = serveAll(servers, listeners, groups)
+	if *portFile != "" {
+		os.Remove(*portFile)
+	}
+	if err != nil {
+		log.Fatalf("Server failed to start: %v", err)
+	}
+}
+
+// newServer creates the HTTP server for one configured server, serving its mock
+// routes alongside the admin endpoints, binds its listener and logs where it can
+// be reached. httpsPort is where redirectToHttps sends requests
+func newServer(config *Config, handler *MockHandler, reload http.HandlerFunc, httpsPort int) (*http.Server, net.Listener, error) {
+	// Server address, listening on all interfaces unless a host is configured
+	// Port 0 lets the system pick a free port, so the listener has the real one
+	addr := net.JoinHostPort(config.Server.Host, strconv.Itoa(config.Server.Port))
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, nil, err
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	if config.Server.Port == 0 {
+		log.Printf("  - Port: %d (picked a free port)", port)
+	} else {
+		log.Printf("  - Port: %d", port)
+	}
+	log.Printf("  - Routes: %d configured", len(config.Routes))
+	logRouteTable(config.Routes)
+	if config.Server.RequestLog != "" {
+		log.Printf("  - Request log: %s", config.Server.RequestLog)
+	}
 
 	// Setup HTTP server with mux
 	mux := http.NewServeMux()
 
 	// Add health check endpoint
-	mux.HandleFunc("/_health", healthCheckHandler)
+	mux.HandleFunc("/_health", handler.healthCheckHandler)
+
+	// Add route listing endpoint
+	mux.HandleFunc("/_routes", handler.routesHandler)
+
+	// Add route contract endpoint describing request constraints and responses
+	mux.HandleFunc("/_contract", handler.contractHandler)
+
+	// Add on-demand config reload endpoint
+	mux.HandleFunc("/_reload", reload)
+
+	// Add endpoint to reset stateful data between test runs
+	mux.HandleFunc("/_reset", handler.resetHandler)
+
+	// Add request metrics endpoint
+	mux.HandleFunc("/_metrics", handler.metricsHandler)
+	mux.HandleFunc("/_metrics/prometheus", handler.prometheusHandler)
 
-	// Add catch-all handler for mock routes
-	mux.Handle("/", handler)
+	// Add catch-all handler for mock routes, wrapped in any configured middleware
+	// Redirecting servers send everything but the admin endpoints to HTTPS instead
+	if config.Server.RedirectToHTTPS {
+		mux.Handle("/", httpsRedirect(httpsPort))
+		log.Printf("  - Redirecting to HTTPS on port %d", httpsPort)
+	} else {
+		mux.Handle("/", applyMiddleware(config.Server.Middleware, handler))
+	}
+	if len(config.Server.Middleware) > 0 {
+		log.Printf("  - Middleware: %s", strings.Join(config.Server.Middleware, ", "))
+	}
+
+	// Wrap with CORS support if configured
+	var root http.Handler = mux
+	if config.Server.CORS != nil {
+		log.Printf("  - CORS: enabled for %v", config.Server.CORS.AllowedOrigins)
+		root = corsMiddleware(config.Server.CORS, mux)
+	}
+
+	// Speak HTTP/2 over plain connections (h2c) as well as HTTP/1.1 if enabled
+	if config.Server.HTTP2 {
+		root = h2c.NewHandler(root, &http2.Server{})
+		log.Printf("  - HTTP/2: enabled, including cleartext (h2c)")
+	}
 
-	// Server address
-	addr := fmt.Sprintf(":%d", config.Server.Port)
+	server := &http.Server{Addr: addr, Handler: root}
+	applyTimeouts(server, config.Server.Timeouts)
 
-	// Start server
-	log.Printf("Starting mockery-api server on http://localhost%s", addr)
-	log.Printf("Health check available at: http://localhost%s/_health", addr)
+	scheme := "http"
+	if config.Server.TLS != nil {
+		scheme = "https"
+	}
+	baseURL := fmt.Sprintf("%s://%s", scheme, displayAddr(config.Server.Host, port))
+
+	log.Printf("Starting mockery-api server on %s", baseURL)
+	log.Printf("Health check available at: %s/_health", baseURL)
+	log.Printf("Route listing available at: %s/_routes", baseURL)
+	log.Printf("Route contract available at: %s/_contract", baseURL)
+	log.Printf("Metrics available at: %s/_metrics", baseURL)
+	return server, listener, nil
+}
+
+// serveAll runs every server until one of them fails or the process is
+// interrupted, then shuts them all down together
+func serveAll(servers []*http.Server, listeners []net.Listener, groups []*Config) error {
+	errs := make(chan error, len(servers))
+	for i, server := range servers {
+		go func() {
+			errs <- serve(server, listeners[i], groups[i].Server.TLS)
+		}()
+	}
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+
+	var err error
+	select {
+	case err = <-errs:
+	case sig := <-stop:
+		log.Printf("Received %s, shutting down", sig)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	for _, server := range servers {
+		server.Shutdown(ctx)
+	}
+	return err
+}
+
+// writePortFile writes each listener's port on its own line, replacing the file
+// atomically so a harness polling for it never reads a partial write
+func writePortFile(path string, listeners []net.Listener) error {
+	var buf bytes.Buffer
+	for _, listener := range listeners {
+		fmt.Fprintln(&buf, listener.Addr().(*net.TCPAddr).Port)
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, buf.Bytes(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// runRecorder serves a recording proxy to upstream until the process is stopped
+func runRecorder(upstream, output string, port int) error {
+	recorder, err := newRecordingProxy(upstream, output, port)
+	if err != nil {
+		return err
+	}
+
+	addr := fmt.Sprintf(":%d", port)
+	log.Printf("Recording requests to %s into %s", upstream, output)
+	log.Printf("Send requests to http://%s", displayAddr("", port))
 	log.Println("Press Ctrl+C to stop")
 	log.Println("---")
 
-	if err := http.ListenAndServe(addr, mux); err != nil {
-		log.Fatalf("Server failed to start: %v", err)
-		os.Exit(1)
+	server := &http.Server{Addr: addr, Handler: recorder}
+	applyTimeouts(server, nil)
+	return server.ListenAndServe()
+}
+
+// logRouteTable logs the routes as an aligned table of method, path, auth and
+// status, so it's easy to confirm at startup that the expected routes loaded
+func logRouteTable(routes []Route) {
+	if len(routes) == 0 {
+		return
+	}
+
+	var buf bytes.Buffer
+	tw := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "    METHOD\tPATH\tAUTH\tSTATUS\t")
+	for _, route := range routes {
+		auth := "-"
+		if route.RequiresAuth {
+			auth = "header " + route.AuthHeader
+			if route.AuthType == authTypeBasic {
+				auth = "basic"
+			}
+		}
+		status := strconv.Itoa(route.firstStatus())
+		if !route.isEnabled() {
+			status += " (disabled)"
+		}
+		fmt.Fprintf(tw, "    %s\t%s\t%s\t%s\t\n", route.methodList(), route.Path, auth, status)
+	}
+	tw.Flush()
+
+	for _, line := range strings.Split(strings.TrimRight(buf.String(), "\n"), "\n") {
+		log.Print(strings.TrimRight(line, " "))
+	}
+}
+
+// httpsRedirect answers every request with a 301 to the same host, path and
+// query on the HTTPS port
+func httpsRedirect(port int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, err := net.SplitHostPort(r.Host)
+		if err != nil {
+			host = strings.Trim(r.Host, "[]")
+		}
+		if port != 443 {
+			host = net.JoinHostPort(host, strconv.Itoa(port))
+		} else if strings.Contains(host, ":") {
+			host = "[" + host + "]"
+		}
+		target := "https://" + host + r.URL.RequestURI()
+		log.Printf("%s %s → 301 %s", r.Method, r.URL.RequestURI(), target)
+		http.Redirect(w, r, target, http.StatusMovedPermanently)
+	})
+}
+
+// displayAddr returns the address to show in startup logs, using localhost
+// when the server listens on all interfaces
+func displayAddr(host string, port int) string {
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		host = "localhost"
+	}
+	return net.JoinHostPort(host, strconv.Itoa(port))
+}
+
+// Default server timeouts, generous enough for delayed and dripped responses
+const (
+	defaultReadTimeout  = 30 * time.Second
+	defaultWriteTimeout = 60 * time.Second
+	defaultIdleTimeout  = 120 * time.Second
+)
+
+// shutdownTimeout bounds how long in-flight requests get to finish on shutdown
+const shutdownTimeout = 5 * time.Second
+
+// applyTimeouts sets the server's read, write and idle timeouts, using the
+// defaults for anything not configured
+func applyTimeouts(server *http.Server, timeouts *TimeoutsConfig) {
+	server.ReadTimeout = defaultReadTimeout
+	server.WriteTimeout = defaultWriteTimeout
+	server.IdleTimeout = defaultIdleTimeout
+	if timeouts == nil {
+		return
+	}
+
+	if timeouts.ReadMs > 0 {
+		server.ReadTimeout = time.Duration(timeouts.ReadMs) * time.Millisecond
+	}
+	if timeouts.WriteMs > 0 {
+		server.WriteTimeout = time.Duration(timeouts.WriteMs) * time.Millisecond
+	}
+	if timeouts.IdleMs > 0 {
+		server.IdleTimeout = time.Duration(timeouts.IdleMs) * time.Millisecond
+	}
+}
+
+// serve accepts connections on the listener over HTTPS when TLS is configured,
+// otherwise plain HTTP
+func serve(server *http.Server, listener net.Listener, tlsConfig *TLSConfig) error {
+	if tlsConfig == nil {
+		return server.Serve(listener)
+	}
+
+	// Use the configured certificate pair if there is one
+	if tlsConfig.CertFile != "" {
+		return server.ServeTLS(listener, tlsConfig.CertFile, tlsConfig.KeyFile)
+	}
+
+	log.Printf("Using a generated self-signed certificate")
+	cert, err := selfSignedCertificate()
+	if err != nil {
+		return fmt.Errorf("failed to generate self-signed certificate: %w", err)
 	}
+	server.TLSConfig = &tls.Config{Certificates: []tls.Certificate{cert}}
+	return server.ServeTLS(listener, "", "")
 }
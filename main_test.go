@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"testing"
+
+	"golang.org/x/net/http2"
+)
+
+func TestHTTPSRedirect(t *testing.T) {
+	tests := []struct {
+		port   int
+		target string
+		want   string
+	}{
+		{8443, "http://localhost:8080/users?page=2", "https://localhost:8443/users?page=2"},
+		{443, "http://example.com/users", "https://example.com/users"},
+		{8443, "http://[::1]:8080/", "https://[::1]:8443/"},
+	}
+	for _, tt := range tests {
+		w := doRequest(httpsRedirect(tt.port), "GET", tt.target, "")
+		if w.Code != http.StatusMovedPermanently {
+			t.Errorf("%s: status %d, want 301", tt.target, w.Code)
+		}
+		if got := w.Header().Get("Location"); got != tt.want {
+			t.Errorf("%s: Location %q, want %q", tt.target, got, tt.want)
+		}
+	}
+}
+
+func TestHTTP2Cleartext(t *testing.T) {
+	config := loadTestConfig(t, `{"server": {"port": 8080, "http2": true}, "routes": [
+		{"method": "GET", "path": "/users", "response": {"status": 200, "body": []}}
+	]}`)
+	config.Server.Port = 0
+	server, listener, err := newServer(config, NewMockHandler(config), func(http.ResponseWriter, *http.Request) {}, 0)
+	if err != nil {
+		t.Fatalf("newServer: %v", err)
+	}
+	go server.Serve(listener)
+	defer server.Close()
+	url := "http://" + listener.Addr().String() + "/users"
+
+	// HTTP/1.1 clients keep working
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatalf("HTTP/1.1: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.ProtoMajor != 1 {
+		t.Errorf("HTTP/1.1: %s %d, want HTTP/1.1 200", resp.Proto, resp.StatusCode)
+	}
+
+	// Clients with prior knowledge speak HTTP/2 straight away
+	client := &http.Client{Transport: &http2.Transport{
+		AllowHTTP: true,
+		DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+			return new(net.Dialer).DialContext(ctx, network, addr)
+		},
+	}}
+	resp, err = client.Get(url)
+	if err != nil {
+		t.Fatalf("HTTP/2 with prior knowledge: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.ProtoMajor != 2 {
+		t.Errorf("HTTP/2 with prior knowledge: %s %d, want HTTP/2.0 200", resp.Proto, resp.StatusCode)
+	}
+
+	// HTTP/1.1 clients can upgrade to HTTP/2
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	fmt.Fprintf(conn, "GET /users HTTP/1.1\r\nHost: localhost\r\nConnection: Upgrade, HTTP2-Settings\r\nUpgrade: h2c\r\nHTTP2-Settings: AAMAAABkAAQAoAAAAAIAAAAA\r\n\r\n")
+	resp, err = http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		t.Fatalf("h2c upgrade: %v", err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols || resp.Header.Get("Upgrade") != "h2c" {
+		t.Errorf("h2c upgrade: status %d, Upgrade %q, want 101 to h2c", resp.StatusCode, resp.Header.Get("Upgrade"))
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Sources that mergeFromRequest and capture values can be read from, written as e.g. "query.name"
+const (
+	mergeSourceQuery  = "query"
+	mergeSourceHeader = "header"
+	mergeSourceParam  = "param"
+	mergeSourceBody   = "body"
+)
+
+// parseMergeSource splits a mergeFromRequest source such as "header.X-User" into its kind and name
+func parseMergeSource(source string) (kind, name string, err error) {
+	kind, name, ok := strings.Cut(source, ".")
+	if !ok || name == "" {
+		return "", "", fmt.Errorf("invalid source %q: expected query.<name>, header.<name>, param.<name> or body.<field>", source)
+	}
+	switch kind {
+	case mergeSourceQuery, mergeSourceHeader, mergeSourceParam, mergeSourceBody:
+		return kind, name, nil
+	}
+	return "", "", fmt.Errorf("invalid source %q: expected query.<name>, header.<name>, param.<name> or body.<field>", source)
+}
+
+// requestValue looks up a merge source on the request, reporting whether it was present
+func requestValue(source string, r *http.Request, params map[string]string) (string, bool) {
+	kind, name, err := parseMergeSource(source)
+	if err != nil {
+		return "", false
+	}
+
+	switch kind {
+	case mergeSourceQuery:
+		query := r.URL.Query()
+		if !query.Has(name) {
+			return "", false
+		}
+		return query.Get(name), true
+	case mergeSourceHeader:
+		values := r.Header.Values(name)
+		if len(values) == 0 {
+			return "", false
+		}
+		return values[0], true
+	case mergeSourceBody:
+		return jsonBodyValue(decodeJSONBody(r), name)
+	default:
+		value, ok := params[name]
+		return value, ok
+	}
+}
+
+// jsonBodyValue looks up a dot-separated field in a JSON body, returning strings
+// as-is and other values as JSON
+func jsonBodyValue(body map[string]interface{}, field string) (string, bool) {
+	var value interface{} = body
+	for _, key := range strings.Split(field, ".") {
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			return "", false
+		}
+		if value, ok = obj[key]; !ok {
+			return "", false
+		}
+	}
+
+	if text, ok := value.(string); ok {
+		return text, true
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return "", false
+	}
+	return string(data), true
+}
+
+// mergeRequestValues sets fields of a rendered body object from the request
+// Fields are dot-separated paths into the body, so "user.name" sets a nested
+// value, creating objects along the way. Sources missing from the request leave
+// the field untouched. The body must already be a copy, since it is modified in place.
+func mergeRequestValues(body interface{}, fields map[string]string, r *http.Request, params map[string]string) {
+	obj, ok := body.(map[string]interface{})
+	if !ok {
+		return
+	}
+
+	for field, source := range fields {
+		value, ok := requestValue(source, r, params)
+		if !ok {
+			continue
+		}
+
+		keys := strings.Split(field, ".")
+		target := obj
+		for _, key := range keys[:len(keys)-1] {
+			next, ok := target[key].(map[string]interface{})
+			if !ok {
+				next = make(map[string]interface{})
+				target[key] = next
+			}
+			target = next
+		}
+		target[keys[len(keys)-1]] = value
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// durationBuckets are the upper bounds, in seconds, of the request duration histogram
+var durationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// seriesKey identifies a Prometheus series by its labels
+type seriesKey struct {
+	method string
+	path   string
+	status int
+}
+
+// histogram accumulates request durations into cumulative buckets
+type histogram struct {
+	buckets []int64
+	sum     float64
+	count   int64
+}
+
+// metrics counts requests per route and tracks their durations
+// Routes are counted by identity, so routes that differ only by matchers are
+// counted separately
+type metrics struct {
+	mu        sync.Mutex
+	hits      map[*Route]int64
+	unmatched int64
+	durations map[seriesKey]*histogram
+}
+
+// newMetrics creates an empty set of counters
+func newMetrics() *metrics {
+	return &metrics{
+		hits:      make(map[*Route]int64),
+		durations: make(map[seriesKey]*histogram),
+	}
+}
+
+// Record counts a request against the route it matched, or as unmatched if route is nil,
+// along with the status returned and how long it took
+func (m *metrics) Record(r *http.Request, route *Route, status int, duration time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := seriesKey{method: r.Method, path: "unmatched", status: status}
+	if route == nil {
+		m.unmatched++
+	} else {
+		m.hits[route]++
+		key.path = route.Path
+	}
+
+	hist, ok := m.durations[key]
+	if !ok {
+		hist = &histogram{buckets: make([]int64, len(durationBuckets))}
+		m.durations[key] = hist
+	}
+	seconds := duration.Seconds()
+	for i, bound := range durationBuckets {
+		if seconds <= bound {
+			hist.buckets[i]++
+		}
+	}
+	hist.sum += seconds
+	hist.count++
+}
+
+// resetRoutes clears the per-route counts, e.g. after routes are reloaded, since
+// they belong to routes that are no longer served
+func (m *metrics) resetRoutes() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.hits = make(map[*Route]int64)
+}
+
+// metricsHandler reports hit counts for every configured route, including routes
+// that were never hit, plus the number of unmatched requests. Routes are listed by
+// method and path, followed by their route number when several share both
+func (h *MockHandler) metricsHandler(w http.ResponseWriter, r *http.Request) {
+	h.mu.RLock()
+	current := h.routes
+	h.mu.RUnlock()
+
+	shared := make(map[string]int, len(current))
+	for i := range current {
+		shared[current[i].String()]++
+	}
+
+	h.metrics.mu.Lock()
+	routes := make(map[string]int64, len(current))
+	for i := range current {
+		key := current[i].String()
+		if shared[key] > 1 {
+			key = fmt.Sprintf("%s (route %d)", key, i)
+		}
+		routes[key] = h.metrics.hits[&current[i]]
+	}
+	unmatched := h.metrics.unmatched
+	h.metrics.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"routes":    routes,
+		"unmatched": unmatched,
+	})
+}
+
+// prometheusHandler reports request totals and duration histograms
+// in the Prometheus text exposition format
+func (h *MockHandler) prometheusHandler(w http.ResponseWriter, r *http.Request) {
+	var totals, durations strings.Builder
+
+	h.metrics.mu.Lock()
+	keys := make([]seriesKey, 0, len(h.metrics.durations))
+	for key := range h.metrics.durations {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if a.path != b.path {
+			return a.path < b.path
+		}
+		if a.method != b.method {
+			return a.method < b.method
+		}
+		return a.status < b.status
+	})
+
+	for _, key := range keys {
+		hist := h.metrics.durations[key]
+		labels := fmt.Sprintf(`method="%s",path="%s",status="%d"`, escapeLabel(key.method), escapeLabel(key.path), key.status)
+
+		fmt.Fprintf(&totals, "mockery_requests_total{%s} %d\n", labels, hist.count)
+		for i, bound := range durationBuckets {
+			fmt.Fprintf(&durations, "mockery_request_duration_seconds_bucket{%s,le=\"%g\"} %d\n", labels, bound, hist.buckets[i])
+		}
+		fmt.Fprintf(&durations, "mockery_request_duration_seconds_bucket{%s,le=\"+Inf\"} %d\n", labels, hist.count)
+		fmt.Fprintf(&durations, "mockery_request_duration_seconds_sum{%s} %g\n", labels, hist.sum)
+		fmt.Fprintf(&durations, "mockery_request_duration_seconds_count{%s} %d\n", labels, hist.count)
+	}
+	h.metrics.mu.Unlock()
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintln(w, "# HELP mockery_requests_total Total number of mock requests handled.")
+	fmt.Fprintln(w, "# TYPE mockery_requests_total counter")
+	fmt.Fprint(w, totals.String())
+	fmt.Fprintln(w, "# HELP mockery_request_duration_seconds Duration of mock requests in seconds.")
+	fmt.Fprintln(w, "# TYPE mockery_request_duration_seconds histogram")
+	fmt.Fprint(w, durations.String())
+}
+
+// escapeLabel escapes a Prometheus label value
+func escapeLabel(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Middleware wraps a handler with behaviour that applies to every request,
+// such as adding headers or rejecting requests before they reach the routes
+type Middleware func(next http.Handler) http.Handler
+
+// builtinMiddleware are the middlewares that can be enabled by name in server.middleware
+var builtinMiddleware = map[string]Middleware{
+	"request-id":    requestIDMiddleware,
+	"response-time": responseTimeMiddleware,
+}
+
+// middlewareNames lists the built-in middleware names for error messages
+func middlewareNames() string {
+	names := make([]string, 0, len(builtinMiddleware))
+	for name := range builtinMiddleware {
+		names = append(names, fmt.Sprintf("%q", name))
+	}
+	slices.Sort(names)
+	return strings.Join(names, ", ")
+}
+
+// applyMiddleware wraps next with the named middlewares, so the first name
+// listed runs first. Names are checked at startup, so unknown ones can't occur
+func applyMiddleware(names []string, next http.Handler) http.Handler {
+	for i := len(names) - 1; i >= 0; i-- {
+		next = builtinMiddleware[names[i]](next)
+	}
+	return next
+}
+
+// requestIDHeader carries the id that identifies a request
+const requestIDHeader = "X-Request-Id"
+
+// newRequestID returns a random id for a request
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// requestID reuses the request's X-Request-Id or generates one, setting it on the
+// request so later handlers see the same id
+func requestID(r *http.Request) string {
+	id := r.Header.Get(requestIDHeader)
+	if id == "" {
+		id = newRequestID()
+		r.Header.Set(requestIDHeader, id)
+	}
+	return id
+}
+
+// requestIDMiddleware gives every request an id, echoing it in the response
+func requestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(requestIDHeader, requestID(r))
+		next.ServeHTTP(w, r)
+	})
+}
+
+// responseTimeMiddleware reports how long the handler took to start responding
+// in an X-Response-Time header, in milliseconds
+func responseTimeMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(&responseTimeWriter{ResponseWriter: w, start: time.Now()}, r)
+	})
+}
+
+// responseTimeWriter sets X-Response-Time just before the headers are sent
+type responseTimeWriter struct {
+	http.ResponseWriter
+	start       time.Time
+	wroteHeader bool
+}
+
+// WriteHeader adds the elapsed time to the headers before sending them
+func (t *responseTimeWriter) WriteHeader(status int) {
+	if !t.wroteHeader {
+		t.wroteHeader = true
+		elapsed := float64(time.Since(t.start)) / float64(time.Millisecond)
+		t.Header().Set("X-Response-Time", fmt.Sprintf("%.3fms", elapsed))
+	}
+	t.ResponseWriter.WriteHeader(status)
+}
+
+// Write sends the headers first if they haven't been sent yet
+func (t *responseTimeWriter) Write(p []byte) (int, error) {
+	if !t.wroteHeader {
+		t.WriteHeader(http.StatusOK)
+	}
+	return t.ResponseWriter.Write(p)
+}
+
+// Unwrap returns the underlying writer, for http.ResponseController
+func (t *responseTimeWriter) Unwrap() http.ResponseWriter {
+	return t.ResponseWriter
+}
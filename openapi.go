@@ -0,0 +1,175 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// generateOpenAPI writes an OpenAPI 3.0 document with an operation per route
+// Paths from a multi-server config each name the server they are served on
+func generateOpenAPI(config *Config, configFile, outputFile string) error {
+	paths := map[string]map[string]interface{}{}
+	servers := []map[string]string{}
+	schemes := map[string]interface{}{}
+	count := 0
+
+	groups := config.serverGroups()
+	for _, group := range groups {
+		server := map[string]string{"url": serverURL(group) + group.Server.BasePath}
+		servers = append(servers, server)
+
+		// Paths already described for another server are kept as they are
+		owned := map[string]bool{}
+		for _, route := range expandMethods(group.Routes) {
+			// Regex and wildcard paths have no OpenAPI equivalent
+			if strings.HasPrefix(route.Path, regexPrefix) || strings.HasSuffix(route.Path, "/*") {
+				log.Printf("Skipping %s %s: regex and wildcard paths can't be described in OpenAPI", route.Method, route.Path)
+				continue
+			}
+
+			// Routes matching any method are documented as a GET, like the curl generator
+			method := strings.ToLower(route.Method)
+			if method == "*" || method == "any" {
+				method = "get"
+			}
+
+			// OpenAPI paths name parameters without their type, e.g. {id:int} becomes {id}
+			path := typedParamPattern.ReplaceAllString(route.Path, "{$1}")
+			if paths[path] == nil {
+				paths[path] = map[string]interface{}{}
+				owned[path] = true
+				if len(groups) > 1 {
+					paths[path]["servers"] = []map[string]string{server}
+				}
+			} else if !owned[path] {
+				log.Printf("Skipping %s %s on port %d: the path is already described for another server", route.Method, route.Path, group.Server.Port)
+				continue
+			}
+			// Routes that differ only by query or body matchers share an operation
+			if _, exists := paths[path][method]; exists {
+				continue
+			}
+
+			operation := buildOperation(route, group.Server.DefaultHeaders)
+			if route.RequiresAuth {
+				name := securitySchemeName(route)
+				schemes[name] = securityScheme(route)
+				operation["security"] = []map[string][]string{{name: {}}}
+			}
+
+			paths[path][method] = operation
+			count++
+		}
+	}
+
+	doc := map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":       "mockery-api",
+			"description": fmt.Sprintf("Auto-generated from %s", configFile),
+			"version":     "1.0.0",
+		},
+		"servers": servers,
+		"paths":   paths,
+	}
+	if len(schemes) > 0 {
+		doc["components"] = map[string]interface{}{"securitySchemes": schemes}
+	}
+
+	out, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode OpenAPI document: %w", err)
+	}
+	if err := os.WriteFile(outputFile, append(out, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write output file: %w", err)
+	}
+
+	fmt.Printf("Generated OpenAPI document for %d operations in %s\n", count, outputFile)
+	return nil
+}
+
+// buildOperation describes a route's parameters and the first response it sends
+func buildOperation(route Route, defaultHeaders map[string]string) map[string]interface{} {
+	resp := route.firstResponse()
+	status := route.firstStatus()
+
+	description := http.StatusText(status)
+	if description == "" {
+		description = "Response"
+	}
+	response := map[string]interface{}{"description": description}
+
+	// Example response body (if not empty/null)
+	if resp.Body != nil && status != 204 {
+		response["content"] = map[string]interface{}{
+			resp.contentType(defaultHeaders): map[string]interface{}{"example": resp.Body},
+		}
+	}
+
+	operation := map[string]interface{}{
+		"summary":   fmt.Sprintf("%s %s", route.Method, route.Path),
+		"responses": map[string]interface{}{fmt.Sprint(status): response},
+	}
+	if params := pathParameters(route.Path); len(params) > 0 {
+		operation["parameters"] = params
+	}
+	return operation
+}
+
+// pathParameters converts {param} segments to OpenAPI path parameters
+func pathParameters(path string) []map[string]interface{} {
+	var params []map[string]interface{}
+	for _, segment := range strings.Split(path, "/") {
+		if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+			name, typ, _ := strings.Cut(strings.Trim(segment, "{}"), ":")
+			params = append(params, map[string]interface{}{
+				"name":     name,
+				"in":       "path",
+				"required": true,
+				"schema":   paramSchema(typ),
+			})
+		}
+	}
+	return params
+}
+
+// paramSchema maps a path parameter type such as {id:int} to an OpenAPI schema
+func paramSchema(typ string) map[string]string {
+	switch typ {
+	case "int":
+		return map[string]string{"type": "integer"}
+	case "uuid":
+		return map[string]string{"type": "string", "format": "uuid"}
+	case "alpha":
+		return map[string]string{"type": "string", "pattern": "^[A-Za-z]+$"}
+	case "alnum":
+		return map[string]string{"type": "string", "pattern": "^[A-Za-z0-9]+$"}
+	}
+	return map[string]string{"type": "string"}
+}
+
+// securitySchemeName derives a component name for a route's auth requirement
+func securitySchemeName(route Route) string {
+	if route.AuthType == authTypeBasic {
+		return "basicAuth"
+	}
+	if route.AuthHeader == "Authorization" {
+		return "bearerAuth"
+	}
+	return strings.ReplaceAll(route.AuthHeader, "-", "") + "Auth"
+}
+
+// securityScheme describes a route's auth requirement, treating Authorization as a bearer token
+func securityScheme(route Route) map[string]string {
+	if route.AuthType == authTypeBasic {
+		return map[string]string{"type": "http", "scheme": "basic"}
+	}
+	if route.AuthHeader == "Authorization" {
+		return map[string]string{"type": "http", "scheme": "bearer"}
+	}
+	return map[string]string{"type": "apiKey", "in": "header", "name": route.AuthHeader}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// paramTypes are the constraints allowed on typed path parameters such as {id:int}
+var paramTypes = map[string]*regexp.Regexp{
+	"int":   regexp.MustCompile(`^-?[0-9]+$`),
+	"alpha": regexp.MustCompile(`^[A-Za-z]+$`),
+	"alnum": regexp.MustCompile(`^[A-Za-z0-9]+$`),
+	"uuid":  regexp.MustCompile(`^[0-9A-Fa-f]{8}-[0-9A-Fa-f]{4}-[0-9A-Fa-f]{4}-[0-9A-Fa-f]{4}-[0-9A-Fa-f]{12}$`),
+}
+
+// parseParam splits a {name} or {name:type} path segment into its name and type
+// It returns false if the segment isn't a parameter
+func parseParam(segment string) (name, typ string, ok bool) {
+	if !strings.HasPrefix(segment, "{") || !strings.HasSuffix(segment, "}") {
+		return "", "", false
+	}
+	name, typ, _ = strings.Cut(segment[1:len(segment)-1], ":")
+	return name, typ, true
+}
+
+// paramMatches checks a path segment against a parameter's type, if it has one
+func paramMatches(typ, value string) bool {
+	if typ == "" {
+		return true
+	}
+	pattern, ok := paramTypes[typ]
+	return ok && pattern.MatchString(value)
+}
+
+// validatePathParams checks that every typed parameter in a route path uses a known type
+func validatePathParams(path string) error {
+	for _, segment := range strings.Split(path, "/") {
+		if _, typ, ok := parseParam(segment); ok && typ != "" {
+			if _, known := paramTypes[typ]; !known {
+				return fmt.Errorf("unknown parameter type %q in %s: must be int, alpha, alnum or uuid", typ, segment)
+			}
+		}
+	}
+	return nil
+}
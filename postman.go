@@ -0,0 +1,171 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// Postman v2.1 collection structures, limited to the fields we fill in
+type postmanCollection struct {
+	Info     postmanInfo       `json:"info"`
+	Item     []postmanItem     `json:"item"`
+	Variable []postmanVariable `json:"variable"`
+}
+
+type postmanInfo struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Schema      string `json:"schema"`
+}
+
+type postmanItem struct {
+	Name     string            `json:"name"`
+	Request  postmanRequest    `json:"request"`
+	Response []postmanResponse `json:"response"`
+}
+
+type postmanRequest struct {
+	Method string            `json:"method"`
+	Header []postmanVariable `json:"header"`
+	URL    postmanURL        `json:"url"`
+}
+
+type postmanURL struct {
+	Raw      string            `json:"raw"`
+	Host     []string          `json:"host"`
+	Path     []string          `json:"path"`
+	Variable []postmanVariable `json:"variable,omitempty"`
+}
+
+type postmanResponse struct {
+	Name            string            `json:"name"`
+	OriginalRequest postmanRequest    `json:"originalRequest"`
+	Status          string            `json:"status"`
+	Code            int               `json:"code"`
+	Header          []postmanVariable `json:"header"`
+	Body            string            `json:"body"`
+}
+
+type postmanVariable struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+const postmanSchema = "https://schema.getpostman.com/json/collection/v2.1.0/collection.json"
+
+// generatePostman writes a Postman collection with a request per route
+// Each server's address is a collection variable: baseUrl for a single server,
+// or baseUrl followed by the port, e.g. baseUrl8081, for each of several
+func generatePostman(config *Config, configFile, outputFile string) error {
+	collection := postmanCollection{
+		Info: postmanInfo{
+			Name:        "mockery-api",
+			Description: fmt.Sprintf("Auto-generated from %s", configFile),
+			Schema:      postmanSchema,
+		},
+	}
+
+	groups := config.serverGroups()
+	for _, group := range groups {
+		variable := "baseUrl"
+		if len(groups) > 1 {
+			variable = fmt.Sprintf("baseUrl%d", group.Server.Port)
+		}
+		collection.Variable = append(collection.Variable, postmanVariable{
+			Key:   variable,
+			Value: serverURL(group) + group.Server.BasePath,
+		})
+
+		for _, route := range expandMethods(group.Routes) {
+			// Regex paths can't be turned into a request URL
+			if strings.HasPrefix(route.Path, regexPrefix) {
+				log.Printf("Skipping %s %s: regex paths can't be converted to a request", route.Method, route.Path)
+				continue
+			}
+			collection.Item = append(collection.Item, buildItem(route, variable, group.Server.DefaultHeaders))
+		}
+	}
+
+	out, err := json.MarshalIndent(collection, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode collection: %w", err)
+	}
+	if err := os.WriteFile(outputFile, append(out, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write output file: %w", err)
+	}
+
+	fmt.Printf("Generated Postman collection with %d requests in %s\n", len(collection.Item), outputFile)
+	return nil
+}
+
+// buildItem describes a route as a request against the server's base URL variable
+func buildItem(route Route, variable string, defaultHeaders map[string]string) postmanItem {
+	// Routes matching any method are documented with a plain GET
+	method := route.Method
+	if method == "*" || method == "ANY" {
+		method = "GET"
+	}
+
+	headers := []postmanVariable{}
+	if route.RequiresAuth && route.AuthType == authTypeBasic {
+		credentials := base64.StdEncoding.EncodeToString([]byte(route.Username + ":" + route.Password))
+		headers = append(headers, postmanVariable{Key: "Authorization", Value: "Basic " + credentials})
+	} else if route.RequiresAuth {
+		authValue := "YOUR_TOKEN_HERE"
+		if route.AuthHeader == "Authorization" {
+			authValue = "Bearer " + authValue
+		}
+		headers = append(headers, postmanVariable{Key: route.AuthHeader, Value: authValue})
+	}
+
+	request := postmanRequest{
+		Method: method,
+		Header: headers,
+		URL:    convertPathToURL(route.Path, variable),
+	}
+
+	item := postmanItem{
+		Name:     fmt.Sprintf("%s %s", route.Method, route.Path),
+		Request:  request,
+		Response: []postmanResponse{},
+	}
+
+	// Example of the first response (if its body isn't empty/null)
+	resp := route.firstResponse()
+	status := route.firstStatus()
+	if resp.Body != nil && status != 204 {
+		body, _ := json.MarshalIndent(resp.Body, "", "  ")
+		item.Response = append(item.Response, postmanResponse{
+			Name:            "Example Response",
+			OriginalRequest: request,
+			Status:          http.StatusText(status),
+			Code:            status,
+			Header:          []postmanVariable{{Key: "Content-Type", Value: resp.contentType(defaultHeaders)}},
+			Body:            string(body),
+		})
+	}
+
+	return item
+}
+
+// convertPathToURL converts {param} segments to Postman :param variables with example values
+func convertPathToURL(path, variable string) postmanURL {
+	host := "{{" + variable + "}}"
+	url := postmanURL{Host: []string{host}}
+
+	for _, segment := range strings.Split(strings.TrimPrefix(path, "/"), "/") {
+		if name, typ, ok := parseParam(segment); ok {
+			url.Variable = append(url.Variable, postmanVariable{Key: name, Value: exampleValue(name, typ)})
+			segment = ":" + name
+		}
+		url.Path = append(url.Path, segment)
+	}
+
+	url.Raw = host + "/" + strings.Join(url.Path, "/")
+	return url
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+)
+
+// proxyRequest forwards the request to the upstream URL and streams the response back
+// Connection failures are reported to the client as a 502
+func proxyRequest(w http.ResponseWriter, r *http.Request, upstream string) {
+	lg := loggerFrom(r)
+
+	target, err := url.Parse(upstream)
+	if err != nil {
+		lg.Errorf("  ✗ Invalid proxy target %s: %v", upstream, err)
+		writeJSONError(w, http.StatusBadGateway, "invalid proxy target")
+		return
+	}
+
+	proxy := &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			pr.SetURL(target)
+			pr.SetXForwarded()
+		},
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			lg.Errorf("  ✗ Proxy to %s failed: %v", upstream, err)
+			writeJSONError(w, http.StatusBadGateway, "upstream unavailable")
+		},
+	}
+
+	lg.Printf("  → Proxying to %s", upstream)
+	proxy.ServeHTTP(w, r)
+}
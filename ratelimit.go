@@ -0,0 +1,97 @@
+package main
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// limiterKey identifies a limiter by the route it applies to, nil for the global
+// limit, and the client IP for per-client limits
+type limiterKey struct {
+	route  *Route
+	client string
+}
+
+// rateLimiters holds token bucket limiters keyed by route and client
+type rateLimiters struct {
+	mu       sync.Mutex
+	limiters map[limiterKey]*rate.Limiter
+}
+
+// newRateLimiters creates an empty set of limiters
+func newRateLimiters() *rateLimiters {
+	return &rateLimiters{limiters: make(map[limiterKey]*rate.Limiter)}
+}
+
+// allow takes a token from the limiter for key, creating it full on first use
+// If none is left, it reports how long until the next one becomes available
+func (l *rateLimiters) allow(key limiterKey, limit *RateLimitConfig) (bool, time.Duration) {
+	l.mu.Lock()
+	limiter, ok := l.limiters[key]
+	if !ok {
+		limiter = rate.NewLimiter(rate.Limit(limit.RequestsPerSecond), max(limit.Burst, 1))
+		l.limiters[key] = limiter
+	}
+	l.mu.Unlock()
+
+	now := time.Now()
+	reservation := limiter.ReserveN(now, 1)
+	if wait := reservation.DelayFrom(now); wait > 0 {
+		// Give the token back, since the request is rejected rather than delayed
+		reservation.CancelAt(now)
+		return false, wait
+	}
+	return true, 0
+}
+
+// reset discards all limiters, e.g. after routes are reloaded
+func (l *rateLimiters) reset() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.limiters = make(map[limiterKey]*rate.Limiter)
+}
+
+// rateLimitKey builds the limiter key for a route, or nil for the global limit,
+// adding the client IP for per-client limits. Routes are keyed by identity, so
+// routes that differ only by matchers are limited separately
+func rateLimitKey(route *Route, limit *RateLimitConfig, ip string) limiterKey {
+	if limit.PerClient {
+		return limiterKey{route, ip}
+	}
+	return limiterKey{route: route}
+}
+
+// retryAfterSeconds rounds a wait duration up to whole seconds for the Retry-After header
+func retryAfterSeconds(wait time.Duration) int {
+	return max(int(math.Ceil(wait.Seconds())), 1)
+}
+
+// clientIP returns the IP address of the client that sent the request
+// When trustProxy is set, X-Forwarded-For and X-Real-IP are honoured so clients
+// behind a reverse proxy are told apart; otherwise only the connection address is used
+func clientIP(r *http.Request, trustProxy bool) string {
+	if trustProxy {
+		// The left-most X-Forwarded-For entry is the original client
+		if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+			first, _, _ := strings.Cut(forwarded, ",")
+			if ip := strings.TrimSpace(first); net.ParseIP(ip) != nil {
+				return ip
+			}
+		}
+		if ip := strings.TrimSpace(r.Header.Get("X-Real-IP")); net.ParseIP(ip) != nil {
+			return ip
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
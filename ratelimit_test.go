@@ -0,0 +1,105 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRateLimitBurst(t *testing.T) {
+	limiters := newRateLimiters()
+	limit := &RateLimitConfig{RequestsPerSecond: 1, Burst: 3}
+
+	for i := range 3 {
+		if ok, _ := limiters.allow(limiterKey{}, limit); !ok {
+			t.Fatalf("request %d rejected within the burst", i+1)
+		}
+	}
+	ok, wait := limiters.allow(limiterKey{}, limit)
+	if ok {
+		t.Fatal("request beyond the burst allowed")
+	}
+	if wait <= 0 || wait > time.Second {
+		t.Errorf("wait %v, want up to 1s for the next token", wait)
+	}
+	if ok, _ := limiters.allow(limiterKey{client: "192.0.2.2"}, limit); !ok {
+		t.Error("a separate key shares the exhausted limiter")
+	}
+}
+
+func TestRateLimitRefill(t *testing.T) {
+	limiters := newRateLimiters()
+	limit := &RateLimitConfig{RequestsPerSecond: 50}
+
+	if ok, _ := limiters.allow(limiterKey{}, limit); !ok {
+		t.Fatal("first request rejected")
+	}
+	if ok, _ := limiters.allow(limiterKey{}, limit); ok {
+		t.Fatal("second request allowed before a token refilled")
+	}
+	time.Sleep(30 * time.Millisecond)
+	if ok, _ := limiters.allow(limiterKey{}, limit); !ok {
+		t.Error("request rejected after a token refilled")
+	}
+}
+
+func TestRateLimitResponse(t *testing.T) {
+	h := newTestHandler(t, `{
+		"server": {"port": 8080},
+		"routes": [{"method": "GET", "path": "/users", "rateLimit": {"requestsPerSecond": 0.5}, "response": {"status": 200}}]
+	}`)
+
+	if w := doRequest(h, "GET", "/users", ""); w.Code != http.StatusOK {
+		t.Fatalf("first request: status %d, want 200", w.Code)
+	}
+	w := doRequest(h, "GET", "/users", "")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("second request: status %d, want 429", w.Code)
+	}
+	if got := w.Header().Get("Retry-After"); got != "2" {
+		t.Errorf("Retry-After %q, want 2", got)
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	tests := []struct {
+		name       string
+		trustProxy bool
+		headers    map[string]string
+		want       string
+	}{
+		{"connection address", false, nil, "192.0.2.1"},
+		{"untrusted forwarded header", false, map[string]string{"X-Forwarded-For": "203.0.113.7"}, "192.0.2.1"},
+		{"single forwarded address", true, map[string]string{"X-Forwarded-For": "203.0.113.7"}, "203.0.113.7"},
+		{"comma-joined forwarded addresses", true, map[string]string{"X-Forwarded-For": "203.0.113.7, 10.0.0.2, 10.0.0.3"}, "203.0.113.7"},
+		{"real IP header", true, map[string]string{"X-Real-IP": "198.51.100.4"}, "198.51.100.4"},
+		{"invalid forwarded address", true, map[string]string{"X-Forwarded-For": "unknown"}, "192.0.2.1"},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		for key, value := range tt.headers {
+			r.Header.Set(key, value)
+		}
+		if got := clientIP(r, tt.trustProxy); got != tt.want {
+			t.Errorf("%s: client IP %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestPerClientRateLimitUsesForwardedAddress(t *testing.T) {
+	h := newTestHandler(t, `{
+		"server": {"port": 8080, "trustProxyHeaders": true},
+		"routes": [{"method": "GET", "path": "/users", "rateLimit": {"requestsPerSecond": 0.1, "perClient": true}, "response": {"status": 200}}]
+	}`)
+
+	if w := doRequest(h, "GET", "/users", "", "X-Forwarded-For", "203.0.113.7"); w.Code != http.StatusOK {
+		t.Fatalf("first client: status %d, want 200", w.Code)
+	}
+	if w := doRequest(h, "GET", "/users", "", "X-Forwarded-For", "203.0.113.8, 10.0.0.1"); w.Code != http.StatusOK {
+		t.Errorf("second client behind the same proxy: status %d, want 200", w.Code)
+	}
+	if w := doRequest(h, "GET", "/users", "", "X-Forwarded-For", "203.0.113.7"); w.Code != http.StatusTooManyRequests {
+		t.Errorf("first client again: status %d, want 429", w.Code)
+	}
+}
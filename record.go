@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"sync"
+	"unicode/utf8"
+)
+
+// recordSkipHeaders are response headers that describe the upstream connection
+// rather than the API, so they are left out of recorded routes
+var recordSkipHeaders = map[string]bool{
+	"Connection":        true,
+	"Content-Encoding":  true,
+	"Content-Length":    true,
+	"Date":              true,
+	"Keep-Alive":        true,
+	"Server":            true,
+	"Transfer-Encoding": true,
+}
+
+// recordPathKey carries the incoming request path through the proxy, since the
+// upstream request's path includes the upstream's own base path
+type recordPathKey struct{}
+
+// recordingProxy forwards every request to an upstream API and saves each
+// response it sees as a route in a config file, so mocks can be bootstrapped
+// from a real API
+type recordingProxy struct {
+	mu     sync.Mutex
+	proxy  *httputil.ReverseProxy
+	output string
+	port   int
+	routes []Route
+	index  map[string]int
+}
+
+// newRecordingProxy creates a proxy to upstream that writes recorded routes to output
+func newRecordingProxy(upstream, output string, port int) (*recordingProxy, error) {
+	target, err := url.Parse(upstream)
+	if err != nil || target.Scheme == "" || target.Host == "" {
+		return nil, fmt.Errorf("upstream must be an absolute URL: %s", upstream)
+	}
+
+	p := &recordingProxy{output: output, port: port, index: make(map[string]int)}
+	p.proxy = &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			pr.SetURL(target)
+			pr.SetXForwarded()
+			// Ask for an uncompressed response so the body can be recorded as-is
+			pr.Out.Header.Del("Accept-Encoding")
+		},
+		ModifyResponse: p.record,
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			log.Printf("  ✗ Proxy to %s failed: %v", upstream, err)
+			writeJSONError(w, http.StatusBadGateway, "upstream unavailable")
+		},
+	}
+	return p, nil
+}
+
+// ServeHTTP proxies the request, recording the upstream response on the way back
+func (p *recordingProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	log.Printf("[%s] %s", r.Method, r.URL.Path)
+	p.proxy.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), recordPathKey{}, r.URL.Path)))
+}
+
+// record captures an upstream response as a route and rewrites the output file
+// Later responses for the same method and path replace earlier ones, and methods
+// a config can't express, such as OPTIONS, are passed through unrecorded
+func (p *recordingProxy) record(resp *http.Response) error {
+	if !validMethods[resp.Request.Method] {
+		log.Printf("  … Not recording %s: method not supported in config", resp.Request.Method)
+		return nil
+	}
+	path, _ := resp.Request.Context().Value(recordPathKey{}).(string)
+
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	route := Route{
+		Path:     path,
+		Method:   resp.Request.Method,
+		Response: recordedResponse(resp, body),
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	key := route.String()
+	if i, ok := p.index[key]; ok {
+		p.routes[i] = route
+	} else {
+		p.index[key] = len(p.routes)
+		p.routes = append(p.routes, route)
+	}
+
+	if err := p.save(); err != nil {
+		log.Printf("  ✗ Failed to write %s: %v", p.output, err)
+		return nil
+	}
+	log.Printf("  ✓ Recorded %s → %d (%d routes in %s)", key, resp.StatusCode, len(p.routes), p.output)
+	return nil
+}
+
+// recordedResponse converts an upstream response to a mock response, keeping JSON
+// bodies as JSON, text as bodyRaw and anything else as bodyBase64
+func recordedResponse(resp *http.Response, body []byte) Response {
+	recorded := Response{Status: resp.StatusCode}
+
+	for key, values := range resp.Header {
+		if recordSkipHeaders[key] || len(values) == 0 {
+			continue
+		}
+		if recorded.Headers == nil {
+			recorded.Headers = make(map[string]string)
+		}
+		recorded.Headers[key] = values[0]
+	}
+
+	var parsed interface{}
+	switch {
+	case len(body) == 0:
+	case isJSONContentType(resp.Header.Get("Content-Type")) && json.Unmarshal(body, &parsed) == nil:
+		recorded.Body = parsed
+	case utf8.Valid(body):
+		recorded.BodyRaw = string(body)
+	default:
+		recorded.BodyBase64 = base64.StdEncoding.EncodeToString(body)
+	}
+	return recorded
+}
+
+// save writes the recorded routes as a config file
+func (p *recordingProxy) save() error {
+	config := Config{
+		Server: ServerConfig{Port: p.port},
+		Routes: p.routes,
+	}
+	data, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(p.output, append(data, '\n'), 0644)
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+func TestRecordUsesIncomingPath(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"path": "` + r.URL.Path + `"}`))
+	}))
+	defer upstream.Close()
+
+	output := filepath.Join(t.TempDir(), "recorded.json")
+	p, err := newRecordingProxy(upstream.URL+"/v1", output, 3000)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if w := doRequest(p, "GET", "/users", ""); w.Code != http.StatusOK {
+		t.Fatalf("GET /users: status %d, want 200", w.Code)
+	}
+	doRequest(p, "OPTIONS", "/users", "")
+
+	config := loadTestConfig(t, readTestFile(t, output))
+	if len(config.Routes) != 1 {
+		t.Fatalf("recorded %d routes, want 1: %+v", len(config.Routes), config.Routes)
+	}
+	if route := config.Routes[0]; route.Method != "GET" || route.Path != "/users" {
+		t.Errorf("recorded %s, want GET /users", route.String())
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import "net/http"
+
+// responseRecorder wraps a ResponseWriter to capture the status code and the
+// number of body bytes written
+type responseRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	written     int64
+}
+
+// newResponseRecorder wraps w, defaulting the status to 200 as net/http does
+func newResponseRecorder(w http.ResponseWriter) *responseRecorder {
+	return &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+}
+
+// WriteHeader records the status code before passing it on
+func (rec *responseRecorder) WriteHeader(status int) {
+	if !rec.wroteHeader {
+		rec.status = status
+		rec.wroteHeader = true
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+// Write marks the header as written, matching net/http's implicit 200, and
+// counts the bytes passed through
+func (rec *responseRecorder) Write(b []byte) (int, error) {
+	rec.wroteHeader = true
+	n, err := rec.ResponseWriter.Write(b)
+	rec.written += int64(n)
+	return n, err
+}
+
+// Flush passes through to the underlying writer when it supports flushing
+func (rec *responseRecorder) Flush() {
+	rec.FlushError()
+}
+
+// FlushError flushes the underlying writer, reporting an error if it can't flush
+func (rec *responseRecorder) FlushError() error {
+	return http.NewResponseController(rec.ResponseWriter).Flush()
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController
+func (rec *responseRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
+// bytesWritten returns the body bytes written so far through a recorder-wrapped writer
+func bytesWritten(w http.ResponseWriter) int64 {
+	for {
+		if rec, ok := w.(*responseRecorder); ok {
+			return rec.written
+		}
+		u, ok := w.(interface{ Unwrap() http.ResponseWriter })
+		if !ok {
+			return 0
+		}
+		w = u.Unwrap()
+	}
+}
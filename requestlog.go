@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// requestLogEntry is a single line in the request log
+type requestLogEntry struct {
+	Time     time.Time           `json:"time"`
+	Method   string              `json:"method"`
+	Path     string              `json:"path"`
+	ClientIP string              `json:"clientIp"`
+	Query    map[string][]string `json:"query,omitempty"`
+	Headers  map[string][]string `json:"headers"`
+	Body     string              `json:"body,omitempty"`
+	Route    string              `json:"route,omitempty"`
+	Status   int                 `json:"status"`
+}
+
+// requestLogger appends requests to a JSONL file
+type requestLogger struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// newRequestLogger opens (or creates) the log file for appending
+func newRequestLogger(filename string) (*requestLogger, error) {
+	f, err := os.OpenFile(filename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &requestLogger{file: f}, nil
+}
+
+// Record appends a request, the route it matched (nil if none) and the status returned
+func (l *requestLogger) Record(r *http.Request, ip string, body []byte, route *Route, status int) error {
+	entry := requestLogEntry{
+		Time:     time.Now().UTC(),
+		Method:   r.Method,
+		Path:     r.URL.Path,
+		ClientIP: ip,
+		Query:    r.URL.Query(),
+		Headers:  r.Header,
+		Body:     string(body),
+		Status:   status,
+	}
+	if route != nil {
+		entry.Route = route.String()
+	}
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, err = l.file.Write(append(line, '\n'))
+	return err
+}
+
+// Close closes the underlying log file
+func (l *requestLogger) Close() error {
+	return l.file.Close()
+}
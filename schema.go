@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/santhosh-tekuri/jsonschema/v6"
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+)
+
+// loadRequestSchemas reads requestSchema files relative to baseDir, replacing each
+// path with the parsed schema, and compiles every schema so requests can be
+// validated against it
+func loadRequestSchemas(config *Config, baseDir string) error {
+	for i := range config.Routes {
+		route := &config.Routes[i]
+		if route.RequestSchema == nil {
+			continue
+		}
+
+		// Inline schemas get a location in baseDir, so relative $refs resolve
+		// from there just like they do for schema files
+		location := filepath.Join(baseDir, fmt.Sprintf("route-%d.schema.json", i))
+		if file, ok := route.RequestSchema.(string); ok {
+			if !filepath.IsAbs(file) {
+				file = filepath.Join(baseDir, file)
+			}
+			data, err := os.ReadFile(file)
+			if err != nil {
+				return fmt.Errorf("route %d: requestSchema not found: %s", i, file)
+			}
+			var schema interface{}
+			if err := json.Unmarshal(data, &schema); err != nil {
+				return fmt.Errorf("route %d: requestSchema %s is not valid JSON: %w", i, file, err)
+			}
+			route.RequestSchema = schema
+			location = file
+		}
+
+		if _, ok := route.RequestSchema.(map[string]interface{}); !ok {
+			return fmt.Errorf("route %d: requestSchema must be a JSON object or a file path", i)
+		}
+
+		compiler := jsonschema.NewCompiler()
+		compiler.AssertFormat()
+		if err := compiler.AddResource(location, route.RequestSchema); err != nil {
+			return fmt.Errorf("route %d: invalid requestSchema: %w", i, err)
+		}
+		schema, err := compiler.Compile(location)
+		if err != nil {
+			return fmt.Errorf("route %d: invalid requestSchema: %w", i, err)
+		}
+		route.requestSchema = schema
+	}
+	return nil
+}
+
+// schemaPrinter formats validation errors
+var schemaPrinter = message.NewPrinter(language.English)
+
+// schemaErrors lists each violation in a validation error as "location: message",
+// where location is a JSON pointer into the request body
+func schemaErrors(err error) []string {
+	var verr *jsonschema.ValidationError
+	if !errors.As(err, &verr) {
+		return []string{err.Error()}
+	}
+	return appendSchemaErrors(nil, verr)
+}
+
+// appendSchemaErrors appends the leaf causes of a validation error, which name the
+// keywords that failed, skipping the wrappers for $ref, allOf and the like
+func appendSchemaErrors(errs []string, verr *jsonschema.ValidationError) []string {
+	if len(verr.Causes) == 0 {
+		location := "/" + strings.Join(verr.InstanceLocation, "/")
+		return append(errs, location+": "+verr.ErrorKind.LocalizedString(schemaPrinter))
+	}
+	for _, cause := range verr.Causes {
+		errs = appendSchemaErrors(errs, cause)
+	}
+	return errs
+}
+
+// checkRequestSchema validates the request's JSON body against the route's schema,
+// writing a 400 with the violations if it doesn't conform
+// It returns false when the request was rejected
+func checkRequestSchema(w http.ResponseWriter, r *http.Request, schema *jsonschema.Schema) bool {
+	lg := loggerFrom(r)
+
+	data, err := bufferBody(r)
+	if err != nil {
+		lg.Errorf("  ✗ Failed to read request body: %v", err)
+		writeJSONError(w, http.StatusBadRequest, "failed to read request body")
+		return false
+	}
+
+	body, err := jsonschema.UnmarshalJSON(bytes.NewReader(data))
+	if err != nil {
+		lg.Errorf("  ✗ Request body is not valid JSON: %v", err)
+		writeJSONError(w, http.StatusBadRequest, "request body is not valid JSON")
+		return false
+	}
+
+	if err := schema.Validate(body); err != nil {
+		errs := schemaErrors(err)
+		lg.Errorf("  ✗ Request body failed schema validation: %s", strings.Join(errs, "; "))
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		enc := json.NewEncoder(w)
+		enc.SetEscapeHTML(false)
+		enc.Encode(struct {
+			Error   string   `json:"error"`
+			Details []string `json:"details"`
+		}{"request body does not match schema", errs})
+		return false
+	}
+
+	lg.Printf("  ✓ Request body matches schema")
+	return true
+}
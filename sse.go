@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// sseContentType is the default Content-Type for server-sent event responses
+const sseContentType = "text/event-stream"
+
+// writeSSE sends the events in the server-sent events format, flushing after each
+// one and waiting the interval between them. With loop set it starts again from
+// the first event until the client goes away; otherwise it stops after the last
+func writeSSE(ctx context.Context, out io.Writer, rc *http.ResponseController, events []SSEEvent, interval time.Duration, loop bool, params map[string]string) error {
+	first := true
+	for {
+		for _, event := range events {
+			if !first && !sleepContext(ctx, interval) {
+				return ctx.Err()
+			}
+			first = false
+
+			if _, err := io.WriteString(out, formatSSE(event, params)); err != nil {
+				return err
+			}
+			// Writers that can't flush still get every event, just not incrementally
+			rc.Flush()
+		}
+		if !loop {
+			return nil
+		}
+	}
+}
+
+// formatSSE renders one event, splitting multi-line data over several data fields
+// String data is sent as-is and anything else as JSON
+func formatSSE(event SSEEvent, params map[string]string) string {
+	var b strings.Builder
+	if event.ID != "" {
+		fmt.Fprintf(&b, "id: %s\n", renderString(event.ID, params))
+	}
+	if event.Event != "" {
+		fmt.Fprintf(&b, "event: %s\n", event.Event)
+	}
+	if event.Retry > 0 {
+		fmt.Fprintf(&b, "retry: %d\n", event.Retry)
+	}
+
+	data, ok := event.Data.(string)
+	if ok {
+		data = renderString(data, params)
+	} else if event.Data != nil {
+		encoded, _ := json.Marshal(renderBody(event.Data, params))
+		data = string(encoded)
+	}
+	for _, line := range strings.Split(data, "\n") {
+		fmt.Fprintf(&b, "data: %s\n", line)
+	}
+	b.WriteString("\n")
+	return b.String()
+}
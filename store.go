@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"strings"
+	"sync"
+)
+
+// memoryStore holds JSON items for stateful routes, grouped into collections by path,
+// and the values captured from requests for {{state.<key>}} placeholders
+type memoryStore struct {
+	mu          sync.Mutex
+	collections map[string][]interface{}
+	nextID      map[string]int
+	values      map[string]string
+}
+
+// newMemoryStore creates an empty store
+func newMemoryStore() *memoryStore {
+	return &memoryStore{
+		collections: make(map[string][]interface{}),
+		nextID:      make(map[string]int),
+		values:      make(map[string]string),
+	}
+}
+
+// Add appends an item to a collection, assigning an "id" to objects that lack one
+func (s *memoryStore) Add(collection string, item interface{}) interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if obj, ok := item.(map[string]interface{}); ok {
+		if _, hasID := obj["id"]; !hasID {
+			s.nextID[collection]++
+			obj["id"] = s.nextID[collection]
+		}
+	}
+
+	s.collections[collection] = append(s.collections[collection], item)
+	return item
+}
+
+// Reset empties every collection, restarts id assignment and forgets captured
+// values, returning the number of items and values removed
+func (s *memoryStore) Reset() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cleared := len(s.values)
+	for _, items := range s.collections {
+		cleared += len(items)
+	}
+	s.collections = make(map[string][]interface{})
+	s.nextID = make(map[string]int)
+	s.values = make(map[string]string)
+	return cleared
+}
+
+// SetValue stores a captured value under a key, replacing any earlier value
+func (s *memoryStore) SetValue(key, value string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.values[key] = value
+}
+
+// Values returns a copy of the captured values
+func (s *memoryStore) Values() map[string]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return maps.Clone(s.values)
+}
+
+// List returns a copy of the items in a collection
+func (s *memoryStore) List(collection string) []interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	items := make([]interface{}, len(s.collections[collection]))
+	copy(items, s.collections[collection])
+	return items
+}
+
+// Get returns the item in a collection with the given id
+func (s *memoryStore) Get(collection, id string) (interface{}, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, item := range s.collections[collection] {
+		if itemID(item) == id {
+			return item, true
+		}
+	}
+	return nil, false
+}
+
+// Delete removes the item in a collection with the given id
+func (s *memoryStore) Delete(collection, id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	items := s.collections[collection]
+	for i, item := range items {
+		if itemID(item) == id {
+			s.collections[collection] = append(items[:i:i], items[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// itemID returns the "id" field of an object as a string, or "" if it has none
+func itemID(item interface{}) string {
+	obj, ok := item.(map[string]interface{})
+	if !ok || obj["id"] == nil {
+		return ""
+	}
+	return fmt.Sprint(obj["id"])
+}
+
+// storeCollection returns the collection key for a stateful route path
+// so that /users and /users/{id}, typed or not, share the same items
+func storeCollection(path string) string {
+	path = strings.TrimSuffix(path, "/")
+	i := strings.LastIndex(path, "/")
+	if name, _, ok := parseParam(path[i+1:]); ok && name == "id" {
+		return path[:max(i, 0)]
+	}
+	return path
+}
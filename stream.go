@@ -0,0 +1,29 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+)
+
+// ndjsonContentType is the default Content-Type for streamed responses
+const ndjsonContentType = "application/x-ndjson"
+
+// writeStream writes each item as a line of JSON, flushing after every line and
+// waiting the interval between them. It stops early if the client goes away
+func writeStream(ctx context.Context, out io.Writer, rc *http.ResponseController, items []interface{}, interval time.Duration, params map[string]string) error {
+	enc := json.NewEncoder(out)
+	for i, item := range items {
+		if i > 0 && !sleepContext(ctx, interval) {
+			return ctx.Err()
+		}
+		if err := enc.Encode(renderBody(item, params)); err != nil {
+			return err
+		}
+		// Writers that can't flush still get the whole stream, just not incrementally
+		rc.Flush()
+	}
+	return nil
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// templateData is the request context available to bodyTemplate
+type templateData struct {
+	Method  string
+	Path    string
+	Params  map[string]string
+	Query   url.Values
+	Headers http.Header
+	Body    string
+	JSON    interface{}
+}
+
+// templateFuncs are the helper functions available to bodyTemplate
+var templateFuncs = template.FuncMap{
+	"now": time.Now,
+	"json": func(v interface{}) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+}
+
+// templateCache holds parsed body templates keyed by their source
+var (
+	templateCacheMu sync.RWMutex
+	templateCache   = make(map[string]*template.Template)
+)
+
+// renderBody returns a copy of a response body with placeholders in string values
+// replaced: {name} with the matching path parameter, {{now}} with the current time
+// and {{uuid}} with a random UUID. Nested objects and arrays are walked recursively,
+// and placeholders without a matching parameter are left as-is.
+func renderBody(value interface{}, params map[string]string) interface{} {
+	switch v := value.(type) {
+	case string:
+		return renderString(v, params)
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			out[key] = renderBody(item, params)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, item := range v {
+			out[i] = renderBody(item, params)
+		}
+		return out
+	default:
+		return value
+	}
+}
+
+// renderString applies all placeholder substitutions to a single string
+func renderString(s string, params map[string]string) string {
+	return replaceTokens(replaceParams(s, params))
+}
+
+// replaceTokens substitutes the {{now}} and {{uuid}} placeholders, generating
+// a fresh value for every occurrence
+func replaceTokens(s string) string {
+	if !strings.Contains(s, "{{") {
+		return s
+	}
+	for strings.Contains(s, "{{now}}") {
+		s = strings.Replace(s, "{{now}}", time.Now().UTC().Format(time.RFC3339), 1)
+	}
+	for strings.Contains(s, "{{uuid}}") {
+		s = strings.Replace(s, "{{uuid}}", newUUID(), 1)
+	}
+	return s
+}
+
+// newUUID returns a random (version 4) UUID
+func newUUID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// statePrefix marks the entries of a params map holding captured state values,
+// which are substituted for {{state.<key>}} rather than {name} placeholders
+const statePrefix = "state."
+
+// requestPrefix marks the entries of a params map holding request body fields,
+// which are substituted for {{req.<field>}} placeholders
+const requestPrefix = "req."
+
+// requestPlaceholder starts a {{req.<field>}} placeholder
+const requestPlaceholder = "{{" + requestPrefix
+
+// usesRequestFields reports whether any of the response's headers or bodies have
+// {{req.<field>}} placeholders, so the request body is only decoded when needed
+func (r *Response) usesRequestFields() bool {
+	for _, value := range r.Headers {
+		if strings.Contains(value, requestPlaceholder) {
+			return true
+		}
+	}
+	for _, event := range r.SSE {
+		if strings.Contains(event.ID, requestPlaceholder) || strings.Contains(event.Event, requestPlaceholder) || hasRequestPlaceholder(event.Data) {
+			return true
+		}
+	}
+	return strings.Contains(r.BodyRaw, requestPlaceholder) || hasRequestPlaceholder(r.Body) ||
+		hasRequestPlaceholder(r.BodyXML) || hasRequestPlaceholder(r.Stream)
+}
+
+// hasRequestPlaceholder reports whether a string in a JSON value, however deeply
+// nested, has a {{req.<field>}} placeholder
+func hasRequestPlaceholder(value interface{}) bool {
+	switch v := value.(type) {
+	case string:
+		return strings.Contains(v, requestPlaceholder)
+	case map[string]interface{}:
+		for _, item := range v {
+			if hasRequestPlaceholder(item) {
+				return true
+			}
+		}
+	case []interface{}:
+		for _, item := range v {
+			if hasRequestPlaceholder(item) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// withRequestBody returns the params with each field of a JSON request body
+// added as req.<field>, using dots for nesting and indexes for array items, e.g.
+// req.user.name or req.items.0.id
+func withRequestBody(params map[string]string, r *http.Request) map[string]string {
+	body := decodeJSONBody(r)
+	if len(body) == 0 {
+		return params
+	}
+	merged := maps.Clone(params)
+	if merged == nil {
+		merged = make(map[string]string)
+	}
+	for key, value := range body {
+		flattenJSON(merged, requestPrefix+key, value)
+	}
+	return merged
+}
+
+// flattenJSON adds a JSON value to out under name, strings as-is and other values
+// as JSON, then adds each of its object fields or array items under name.<key>
+func flattenJSON(out map[string]string, name string, value interface{}) {
+	if text, ok := value.(string); ok {
+		out[name] = text
+	} else if data, err := json.Marshal(value); err == nil {
+		out[name] = string(data)
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			flattenJSON(out, name+"."+key, item)
+		}
+	case []interface{}:
+		for i, item := range v {
+			flattenJSON(out, name+"."+strconv.Itoa(i), item)
+		}
+	}
+}
+
+// replaceParams substitutes {name} placeholders in s with their parameter values,
+// {{state.<key>}} placeholders with captured state values and {{req.<field>}}
+// placeholders with request body fields
+// Placeholders are replaced in a single pass, so one inside a substituted value is
+// left as it is, and parameters are tried in name order to keep the result stable
+func replaceParams(s string, params map[string]string) string {
+	if !strings.Contains(s, "{") || len(params) == 0 {
+		return s
+	}
+	pairs := make([]string, 0, 2*len(params))
+	for _, name := range slices.Sorted(maps.Keys(params)) {
+		placeholder := "{" + name + "}"
+		if strings.HasPrefix(name, statePrefix) || strings.HasPrefix(name, requestPrefix) {
+			placeholder = "{" + placeholder + "}"
+		}
+		pairs = append(pairs, placeholder, params[name])
+	}
+	return strings.NewReplacer(pairs...).Replace(s)
+}
+
+// parseBodyTemplate parses a bodyTemplate, caching the result by source
+func parseBodyTemplate(source string) (*template.Template, error) {
+	templateCacheMu.RLock()
+	tmpl, ok := templateCache[source]
+	templateCacheMu.RUnlock()
+	if ok {
+		return tmpl, nil
+	}
+
+	tmpl, err := template.New("body").Funcs(templateFuncs).Parse(source)
+	if err != nil {
+		return nil, err
+	}
+
+	templateCacheMu.Lock()
+	templateCache[source] = tmpl
+	templateCacheMu.Unlock()
+	return tmpl, nil
+}
+
+// renderBodyTemplate executes a bodyTemplate against the request
+func renderBodyTemplate(source string, r *http.Request, params map[string]string) ([]byte, error) {
+	tmpl, err := parseBodyTemplate(source)
+	if err != nil {
+		return nil, err
+	}
+
+	data := templateData{
+		Method:  r.Method,
+		Path:    r.URL.Path,
+		Params:  params,
+		Query:   r.URL.Query(),
+		Headers: r.Header,
+	}
+	if body, err := bufferBody(r); err == nil {
+		data.Body = string(body)
+		json.Unmarshal(body, &data.JSON)
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// watchConfig polls the config file for changes and reloads the handlers' routes
+// If the new config fails to load or validate, the current routes are kept
+func watchConfig(filename string, handlers []*MockHandler, interval time.Duration) {
+	lastMod, lastSize := fileStamp(filename)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		mod, size := fileStamp(filename)
+		if mod.Equal(lastMod) && size == lastSize {
+			continue
+		}
+		lastMod, lastSize = mod, size
+
+		log.Printf("Config file changed, reloading: %s", filename)
+		config, err := reloadConfig(filename, handlers)
+		if err != nil {
+			log.Printf("  ✗ Reload failed, keeping previous routes: %v", err)
+			continue
+		}
+		log.Printf("  ✓ Reloaded %d routes", config.routeCount())
+	}
+}
+
+// reloadConfig loads the config file and hands each server's routes to its handler
+// Listeners can't be added or removed while running, so the number of servers must not change
+func reloadConfig(filename string, handlers []*MockHandler) (*Config, error) {
+	if filename == stdinConfig {
+		return nil, fmt.Errorf("config was read from stdin and can't be reloaded, restart to apply changes")
+	}
+	config, err := LoadConfig(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	groups := config.serverGroups()
+	if len(groups) != len(handlers) {
+		return nil, fmt.Errorf("number of servers changed from %d to %d, restart to apply", len(handlers), len(groups))
+	}
+	for i, group := range groups {
+		handlers[i].Reload(group)
+	}
+	return config, nil
+}
+
+// fileStamp returns the modification time and size of a file, or the latest time and
+// total size of the JSON files in a config directory, or zero values if it can't be read
+func fileStamp(filename string) (time.Time, int64) {
+	info, err := os.Stat(filename)
+	if err != nil {
+		return time.Time{}, 0
+	}
+	if !info.IsDir() {
+		return info.ModTime(), info.Size()
+	}
+
+	// For a config directory, combine its JSON files so editing any of them counts,
+	// with the directory's own time catching files being added or removed
+	mod, size := info.ModTime(), int64(0)
+	files, _ := filepath.Glob(filepath.Join(filename, "*.json"))
+	for _, file := range files {
+		fileMod, fileSize := fileStamp(file)
+		if fileMod.After(mod) {
+			mod = fileMod
+		}
+		size += fileSize
+	}
+	return mod, size
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// xmlContentType is the default Content-Type for bodyXml responses
+const xmlContentType = "application/xml"
+
+// validateXMLBody checks a bodyXml value: either a well-formed XML string or an
+// object with a single key naming the root element
+func validateXMLBody(body interface{}) error {
+	switch v := body.(type) {
+	case string:
+		dec := xml.NewDecoder(strings.NewReader(v))
+		for {
+			_, err := dec.Token()
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+		}
+	case map[string]interface{}:
+		if len(v) != 1 {
+			return fmt.Errorf("object must have exactly one key, the root element")
+		}
+		return nil
+	}
+	return fmt.Errorf("must be an XML string or an object")
+}
+
+// writeXMLBody writes a bodyXml value, sending strings as they are and
+// converting objects to XML elements, after substituting path parameters
+func writeXMLBody(w io.Writer, body interface{}, params map[string]string) error {
+	if text, ok := body.(string); ok {
+		_, err := io.WriteString(w, renderString(text, params))
+		return err
+	}
+
+	root, _ := renderBody(body, params).(map[string]interface{})
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	for name, value := range root {
+		if err := encodeXMLElement(enc, name, value); err != nil {
+			return err
+		}
+	}
+	return enc.Close()
+}
+
+// encodeXMLElement writes a JSON value as an element named name
+// Object keys become child elements in sorted order, except keys starting with
+// @ which become attributes and #text which becomes the element's text. Arrays
+// repeat the element once per item.
+func encodeXMLElement(enc *xml.Encoder, name string, value interface{}) error {
+	if items, ok := value.([]interface{}); ok {
+		for _, item := range items {
+			if err := encodeXMLElement(enc, name, item); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	start := xml.StartElement{Name: xml.Name{Local: name}}
+	obj, isObject := value.(map[string]interface{})
+	keys := make([]string, 0, len(obj))
+	for key := range obj {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if attr, ok := strings.CutPrefix(key, "@"); ok {
+			start.Attr = append(start.Attr, xml.Attr{Name: xml.Name{Local: attr}, Value: xmlText(obj[key])})
+		}
+	}
+
+	if err := enc.EncodeToken(start); err != nil {
+		return err
+	}
+	if isObject {
+		for _, key := range keys {
+			var err error
+			switch {
+			case strings.HasPrefix(key, "@"):
+			case key == "#text":
+				err = enc.EncodeToken(xml.CharData(xmlText(obj[key])))
+			default:
+				err = encodeXMLElement(enc, key, obj[key])
+			}
+			if err != nil {
+				return err
+			}
+		}
+	} else if value != nil {
+		if err := enc.EncodeToken(xml.CharData(xmlText(value))); err != nil {
+			return err
+		}
+	}
+	return enc.EncodeToken(start.End())
+}
+
+// xmlText formats a scalar JSON value as XML text
+func xmlText(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case string:
+		return v
+	}
+	return fmt.Sprint(value)
+}